@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+)
+
+// runConfig handles the config subcommands.
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: goimporter config <schema|validate|show|profiles>")
+	}
+
+	switch args[0] {
+	case "schema":
+		_, err := os.Stdout.Write(config.Schema())
+		return errors.Wrap(err, "writing schema")
+	case "validate":
+		return validateConfig(args[1:])
+	case "show":
+		return showConfig(args[1:])
+	case "profiles":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, p := range config.Profiles() {
+			fmt.Fprintf(w, "%s\t%s\n", p.Name, p.Description)
+		}
+		return errors.Wrap(w.Flush(), "writing profiles")
+	default:
+		return errors.Errorf("unknown config command %q", args[0])
+	}
+}
+
+// validateConfig validates the given config files, or the effective configuration of -dir.
+func validateConfig(args []string) error {
+	fs := flag.NewFlagSet("goimporter config validate", flag.ContinueOnError)
+	cfg, err := config.Parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		_, err := cfg.RepoForDir(cfg.Dir)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Config is valid")
+		return nil
+	}
+
+	for _, path := range fs.Args() {
+		err := config.ValidateFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Valid: %s\n", path)
+	}
+	return nil
+}
+
+// showConfig prints the effective configuration of -dir and where each value came from.
+func showConfig(args []string) error {
+	fs := flag.NewFlagSet("goimporter config show", flag.ContinueOnError)
+	cfg, err := config.Parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	settings, err := cfg.Describe(cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%q\t%s\n", s.Key, s.Value, s.Source)
+	}
+	return errors.Wrap(w.Flush(), "writing config")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/formatter"
+)
+
+// runGraph prints the import dependency graph of the tree.
+func runGraph(args []string) error {
+	fs := flag.NewFlagSet("goimporter graph", flag.ContinueOnError)
+	level := fs.String("level", formatter.GraphPackage, "Graph nodes: package, project or group")
+	output := fs.String("output", formatter.GraphDOT, "Graph output format: dot, json or mermaid")
+	stdlib := fs.Bool("stdlib", false, "Include standard library packages")
+
+	cfg, err := config.Parse(fs, args)
+	if err != nil {
+		return err
+	}
+	// The graph format is set with -output, -format is for check and stats output.
+	err = rejectFlags(fs, append([]string{"format"}, formattingFlags...)...)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case formatter.GraphDOT, formatter.GraphJSON, formatter.GraphMermaid:
+	default:
+		return errors.Errorf("unknown graph format %q, use dot, json or mermaid", *output)
+	}
+
+	// Graphs cover the whole tree.
+	cfg.Recursive = true
+	graph, err := formatter.BuildGraph(cfg, *level, *stdlib)
+	if err != nil {
+		return err
+	}
+	return formatter.WriteGraph(os.Stdout, *output, graph)
+}
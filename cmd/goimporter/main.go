@@ -1,19 +1,62 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"slices"
+
+	"github.com/pkg/errors"
 
 	"goimporter/config"
 	"goimporter/formatter"
 )
 
+// commands maps subcommand names to their handlers.
+var commands = map[string]func(args []string) error{
+	"config":  runConfig,
+	"graph":   runGraph,
+	"migrate": runMigrate,
+	"stats":   runStats,
+}
+
+// formattingFlags lists the flags registered by config.Parse that only apply to formatting and
+// checking files, not to the reports of the graph and stats commands.
+var formattingFlags = []string{"check", "d", "diff", "fix", "remove-unused", "add-missing", "normalize-build"}
+
+// rejectFlags returns an error if any of the named flags was given to a command.
+func rejectFlags(fs *flag.FlagSet, names ...string) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err == nil && slices.Contains(names, f.Name) {
+			err = errors.Errorf("flag -%s does not apply to %s", f.Name, fs.Name())
+		}
+	})
+	return err
+}
+
 func main() {
+	// Dispatch subcommands.
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			err := command(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// Parse command-line flags.
-	cfg := config.ParseFlags()
+	cfg, err := config.ParseFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Process Go files according to the configuration.
-	err := formatter.ProcessGoFiles(cfg)
+	err = formatter.ProcessGoFiles(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
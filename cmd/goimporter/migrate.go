@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/formatter"
+)
+
+// runMigrate moves import paths from one prefix to another in every Go file of the tree and regroups
+// the changed files that are not generated.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("goimporter migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "Import path prefix to move")
+	to := fs.String("to", "", "Import path prefix to move to")
+
+	cfg, err := config.Parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("usage: goimporter migrate -from <prefix> -to <prefix> [flags] [files]")
+	}
+
+	// Migrations apply to the whole tree.
+	cfg.Recursive = true
+	return formatter.MigrateGoFiles(cfg, *from, *to)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/formatter"
+)
+
+// runStats prints import statistics of the tree.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("goimporter stats", flag.ContinueOnError)
+	top := fs.Int("top", 10, "Number of entries listed per table, 0 for all")
+
+	cfg, err := config.Parse(fs, args)
+	if err != nil {
+		return err
+	}
+	err = rejectFlags(fs, formattingFlags...)
+	if err != nil {
+		return err
+	}
+	if cfg.Format == config.FormatSARIF {
+		return errors.New("stats can be written as text or json")
+	}
+
+	// Statistics cover the whole tree.
+	cfg.Recursive = true
+	stats, err := formatter.CollectStats(cfg, *top)
+	if err != nil {
+		return err
+	}
+	return formatter.WriteStats(os.Stdout, cfg.Format, stats)
+}
@@ -1,10 +1,11 @@
 package config
 
 import (
-	"encoding/json"
 	"flag"
-	"fmt"
+	"go/build"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 
 	"goimporter/entities"
@@ -17,12 +18,96 @@ type Config struct {
 	Dir         string
 	Recursive   bool
 	DryRun      bool
+	Check       bool
 	ExcludeMock bool
 	PkgPrefixes []string
 	ConfigPath  string
-	Repo        *entities.RepoConfig
+	Discover    bool
+
+	// Files given as arguments, processed instead of Dir.
+	Files []string
+
+	// Format generated files too.
+	IncludeGenerated bool
+
+	// Add //go:build lines matching existing // +build lines.
+	NormalizeBuild bool
+
+	// Remove imports whose package is not used.
+	RemoveUnused bool
+
+	// Add imports for unresolved package selectors.
+	AddMissing bool
+
+	// Apply fixes for policy violations.
+	Fix bool
+
+	// Print a diff of the changes instead of writing them.
+	Diff bool
+
+	// Output format of check mode: text, json or sarif.
+	Format string
+
+	// Import path moves applied to every file, set by the migrate command.
+	Migrations []entities.ImportRule
+
+	// Names import paths are imported by in most of the processed files, by import path,
+	// for alias_policy.consistent. Set when processing a tree.
+	ImportNames map[string]string
+
+	// Build context filters. Without any, files of every build variant are processed.
+	Tags   []string
+	GOOS   string
+	GOARCH string
+
+	// Effective repository configuration, without discovered config files.
+	Repo *entities.RepoConfig
+
+	// Built-in defaults and global user config, the base for discovered config files.
+	base *resolved
+
+	// Layers applied on top of discovered config files: -config file, environment and flags.
+	overrides []*layer
+
+	// Origin of each key of Repo, by key name.
+	sources map[string]string
+
+	// Discovered config files and effective configurations by directory.
+	discovered map[string]*resolved
+	effective  map[string]*resolved
+}
+
+// resolved is a repository configuration together with the origin of each key.
+type resolved struct {
+	repo    *entities.RepoConfig
+	sources map[string]string
 }
 
+// repoFlags maps command-line flags to config keys.
+var repoFlags = []struct {
+	name  string
+	key   string
+	usage string
+}{
+	{"profile", "profile", "Named import style profile (default, goimports, gci, uber, vk)"},
+	{"org", "org_prefix", "Organization prefix"},
+	{"repo", "repo_prefix", "Repository prefix"},
+	{"common-prefix", "common_prefix", "Common packages prefix"},
+	{"domain-prefix", "domain_prefix", "Domain-specific packages prefix"},
+	{"projects-tpl", "projects_template", "Projects template"},
+	{"replace-grouping", "replace_grouping", "Grouping of go.mod replaced modules (original, local, org)"},
+}
+
+// Output formats of check mode.
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+// envPrefix prefixes environment variables overriding config keys, e.g. GOIMPORTER_ORG_PREFIX.
+const envPrefix = "GOIMPORTER_"
+
 // DefaultRepoConfig creates a default repository configuration.
 func DefaultRepoConfig() *entities.RepoConfig {
 	return &entities.RepoConfig{
@@ -35,34 +120,65 @@ func DefaultRepoConfig() *entities.RepoConfig {
 }
 
 // ParseFlags parses command line arguments into a Config.
-func ParseFlags() *Config {
-	cfg := &Config{
-		Repo: DefaultRepoConfig(),
-	}
+func ParseFlags() (*Config, error) {
+	return Parse(flag.CommandLine, os.Args[1:])
+}
+
+// Parse registers the configuration flags on a flag set and parses args into a Config.
+// Callers may register additional flags on the set beforehand.
+//
+// The repository configuration is resolved from, in increasing precedence:
+// built-in defaults, the global user config, discovered repository config files,
+// the -config file, GOIMPORTER_* environment variables and explicitly set flags.
+func Parse(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := &Config{}
 
-	flag.StringVar(&cfg.Dir, "dir", ".", "Directory to process")
-	flag.BoolVar(&cfg.Recursive, "r", false, "Process files recursively")
-	flag.BoolVar(&cfg.DryRun, "d", false, "Don't write changes, just report")
-	flag.BoolVar(&cfg.ExcludeMock, "exclude-mock", true, "Exclude mock files")
-	flag.StringVar(&cfg.ConfigPath, "config", "", "Path to config file (JSON)")
+	fs.StringVar(&cfg.Dir, "dir", ".", "Directory to process")
+	fs.BoolVar(&cfg.Recursive, "r", false, "Process files recursively")
+	fs.BoolVar(&cfg.DryRun, "d", false, "Don't write changes, just report")
+	fs.BoolVar(&cfg.Diff, "diff", false, "Print a diff of the changes instead of writing them")
+	fs.BoolVar(&cfg.Check, "check", false, "Report unsorted imports and import violations without writing changes")
+	fs.StringVar(&cfg.Format, "format", FormatText, "Output format of check mode (text, json, sarif)")
+	fs.BoolVar(&cfg.ExcludeMock, "exclude-mock", true, "Exclude mock files")
+	fs.BoolVar(&cfg.IncludeGenerated, "include-generated", false, "Format generated files too")
+	fs.BoolVar(&cfg.RemoveUnused, "remove-unused", false, "Remove unused imports, keeping blank and dot imports")
+	fs.BoolVar(&cfg.AddMissing, "add-missing", false, "Add imports for unresolved package selectors")
+	fs.BoolVar(&cfg.Fix, "fix", false, "Apply fixes for import policy violations, e.g. aliases and deprecated imports")
+	fs.BoolVar(&cfg.NormalizeBuild, "normalize-build", false, "Add //go:build lines matching existing // +build lines")
+	fs.StringVar(&cfg.ConfigPath, "config", "", "Path to config file (JSON, YAML or TOML)")
+	fs.BoolVar(&cfg.Discover, "discover", true, "Discover .goimporter config files in parent directories")
 
 	// Repository configuration flags.
-	flag.StringVar(&cfg.Repo.OrgPrefix, "org", cfg.Repo.OrgPrefix, "Organization prefix")
-	flag.StringVar(&cfg.Repo.RepoPrefix, "repo", cfg.Repo.RepoPrefix, "Repository prefix")
-	flag.StringVar(&cfg.Repo.CommonPrefix, "common-prefix", cfg.Repo.CommonPrefix, "Common packages prefix")
-	flag.StringVar(&cfg.Repo.DomainPrefix, "domain-prefix", cfg.Repo.DomainPrefix, "Domain-specific packages prefix")
-	flag.StringVar(&cfg.Repo.ProjectsTemplate, "projects-tpl", cfg.Repo.ProjectsTemplate, "Projects template")
+	defaults := DefaultRepoConfig()
+	for _, f := range repoFlags {
+		fs.String(f.name, formatKey(defaults, f.key), f.usage)
+	}
 
-	customPkgs := flag.String("pkgs", "", "Custom package prefixes (comma-separated)")
+	fs.StringVar(&cfg.GOOS, "goos", "", "Only process files matching this GOOS")
+	fs.StringVar(&cfg.GOARCH, "goarch", "", "Only process files matching this GOARCH")
+	tags := fs.String("tags", "", "Only process files matching these build tags (comma-separated)")
 
-	flag.Parse()
+	customPkgs := fs.String("pkgs", "", "Custom package prefixes (comma-separated)")
 
-	// Load config file if specified.
-	if cfg.ConfigPath != "" {
-		err := cfg.loadConfigFile()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing flags")
+	}
+
+	switch cfg.Format {
+	case FormatText, FormatJSON, FormatSARIF:
+	default:
+		return nil, errors.Errorf("unknown output format %q, use %s, %s or %s", cfg.Format, FormatText, FormatJSON, FormatSARIF)
+	}
+
+	cfg.Files = fs.Args()
+	if *tags != "" {
+		cfg.Tags = strings.Split(*tags, ",")
+	}
+
+	err = cfg.loadLayers(fs)
+	if err != nil {
+		return nil, err
 	}
 
 	// Command-line flags override config file.
@@ -70,23 +186,198 @@ func ParseFlags() *Config {
 		cfg.PkgPrefixes = strings.Split(*customPkgs, ",")
 	}
 
-	return cfg
+	return cfg, nil
 }
 
-// loadConfigFile loads configuration from a JSON file.
-func (c *Config) loadConfigFile() error {
-	data, err := os.ReadFile(c.ConfigPath)
+// loadLayers resolves the base configuration and the overriding layers.
+func (c *Config) loadLayers(fs *flag.FlagSet) error {
+	base := defaultLayer().apply(&resolved{repo: &entities.RepoConfig{}})
+
+	global, err := globalLayer()
+	if err != nil {
+		return err
+	}
+	if global != nil {
+		base = global.apply(base)
+	}
+	c.base = base
+
+	// Explicit config file.
+	if c.ConfigPath != "" {
+		l, err := fileLayer(c.ConfigPath)
+		if err != nil {
+			return err
+		}
+		c.overrides = append(c.overrides, l)
+	}
+
+	// Environment variables.
+	l, err := envLayer()
 	if err != nil {
-		return errors.Wrap(err, "reading config file")
+		return err
 	}
+	c.overrides = append(c.overrides, l)
 
-	var repo entities.RepoConfig
-	err = json.Unmarshal(data, &repo)
+	// Explicitly set flags.
+	l, err = flagLayer(fs)
 	if err != nil {
-		return errors.Wrap(err, "parsing config file")
+		return err
 	}
+	c.overrides = append(c.overrides, l)
+
+	r := c.applyOverrides(base)
+	c.Repo = r.repo
+	c.sources = r.sources
 
-	// Update config with values from file.
-	c.Repo = &repo
+	// Validate the configuration used for -dir, including the config files discovered for it.
+	if !c.Discover {
+		return validate(c.Repo, c.sources)
+	}
+	_, err = c.resolveDir(c.Dir)
+	return err
+}
+
+// SetRepo sets the repository configuration used for every file, without config files, environment
+// variables or flags, e.g. for embedding. Keys left at their zero value take the values of the
+// selected profile or the built-in defaults, and the result is validated.
+func (c *Config) SetRepo(repo *entities.RepoConfig) error {
+	if repo == nil {
+		return errors.New("no repository configuration")
+	}
+
+	l := &layer{repo: repo.Clone(), sources: make(map[string]string)}
+	values := reflect.ValueOf(l.repo).Elem()
+	for _, key := range repoKeys() {
+		if !values.FieldByIndex(keyField(key).Index).IsZero() {
+			l.keys = append(l.keys, key)
+			l.sources[key] = repoSource
+		}
+	}
+
+	r := applyProfile(l.apply(defaultLayer().apply(&resolved{repo: &entities.RepoConfig{}})))
+	err := validate(r.repo, r.sources)
+	if err != nil {
+		return err
+	}
+
+	c.Discover = false
+	c.Repo, c.sources = r.repo, r.sources
 	return nil
 }
+
+// applyOverrides applies the overriding layers and then the selected profile on top of a configuration.
+func (c *Config) applyOverrides(r *resolved) *resolved {
+	for _, l := range c.overrides {
+		r = l.apply(r)
+	}
+	return applyProfile(r)
+}
+
+// BuildContext returns the build context files must match, or nil if no -tags, -goos
+// or -goarch filter is set.
+func (c *Config) BuildContext() *build.Context {
+	if len(c.Tags) == 0 && c.GOOS == "" && c.GOARCH == "" {
+		return nil
+	}
+
+	ctx := build.Default
+	ctx.BuildTags = c.Tags
+	if c.GOOS != "" {
+		ctx.GOOS = c.GOOS
+	}
+	if c.GOARCH != "" {
+		ctx.GOARCH = c.GOARCH
+	}
+	return &ctx
+}
+
+// RepoFor returns the repository configuration for a file.
+// With discovery enabled, the nearest config files from the repository root
+// down to the file's directory are merged on top of the base configuration,
+// so settings in nested directories override those of their parents.
+func (c *Config) RepoFor(filename string) (*entities.RepoConfig, error) {
+	return c.RepoForDir(filepath.Dir(filename))
+}
+
+// RepoForDir returns the repository configuration for files in a directory.
+func (c *Config) RepoForDir(dir string) (*entities.RepoConfig, error) {
+	r, err := c.resolveDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return r.repo, nil
+}
+
+// resolveDir resolves the effective configuration for a directory.
+func (c *Config) resolveDir(dir string) (*resolved, error) {
+	if !c.Discover {
+		return &resolved{repo: c.Repo, sources: c.sources}, nil
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving path")
+	}
+
+	if r, ok := c.effective[absDir]; ok {
+		return r, nil
+	}
+
+	r, err := c.discoverDir(absDir)
+	if err != nil {
+		return nil, err
+	}
+
+	r = c.applyOverrides(r)
+	err = validate(r.repo, r.sources)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.effective == nil {
+		c.effective = make(map[string]*resolved)
+	}
+	c.effective[absDir] = r
+	return r, nil
+}
+
+// discoverDir merges the config files from the repository root down to a directory.
+func (c *Config) discoverDir(dir string) (*resolved, error) {
+	if r, ok := c.discovered[dir]; ok {
+		return r, nil
+	}
+
+	// Stop at the repository root or the filesystem root.
+	parent := c.base
+	if parent == nil {
+		parent = &resolved{repo: c.Repo, sources: c.sources}
+	}
+	if !isRepoRoot(dir) && filepath.Dir(dir) != dir {
+		var err error
+		parent, err = c.discoverDir(filepath.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r := parent
+	if path := findConfigFile(dir, configFileNames); path != "" {
+		l, err := fileLayer(path)
+		if err != nil {
+			return nil, err
+		}
+		r = l.apply(parent)
+	}
+
+	if c.discovered == nil {
+		c.discovered = make(map[string]*resolved)
+	}
+	c.discovered[dir] = r
+	return r, nil
+}
+
+// isRepoRoot checks if a directory is the root of a repository.
+func isRepoRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
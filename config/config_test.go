@@ -0,0 +1,567 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"goimporter/entities"
+)
+
+func TestRepoFor(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".git", "HEAD"), "ref: refs/heads/master\n")
+	writeFile(t, filepath.Join(root, ".goimporter.json"), `{
+  "org_prefix": "gitlab.mvk.com",
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "projects_template": "gitlab.mvk.com/go/vkgo/projects/health/%s"
+}`)
+	writeFile(t, filepath.Join(root, "projects", "payments", ".goimporter.json"), `{
+  "projects_template": "gitlab.mvk.com/go/vkgo/projects/payments/%s",
+  "additional_common_prefixes": ["gitlab.mvk.com/vkapi/vk-go-sdk-private"]
+}`)
+
+	cfg := &Config{
+		Discover: true,
+		Repo: &entities.RepoConfig{
+			OrgPrefix:    "github.com/myorg",
+			CommonPrefix: "gitlab.mvk.com/go/vkgo/pkg",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		want     *entities.RepoConfig
+	}{
+		{
+			name:     "root config",
+			filename: filepath.Join(root, "pkg", "util", "util.go"),
+			want: &entities.RepoConfig{
+				OrgPrefix:        "gitlab.mvk.com",
+				RepoPrefix:       "gitlab.mvk.com/go/vkgo",
+				CommonPrefix:     "gitlab.mvk.com/go/vkgo/pkg",
+				ProjectsTemplate: "gitlab.mvk.com/go/vkgo/projects/health/%s",
+			},
+		},
+		{
+			name:     "nested config overrides parent",
+			filename: filepath.Join(root, "projects", "payments", "billing", "main.go"),
+			want: &entities.RepoConfig{
+				OrgPrefix:                "gitlab.mvk.com",
+				RepoPrefix:               "gitlab.mvk.com/go/vkgo",
+				CommonPrefix:             "gitlab.mvk.com/go/vkgo/pkg",
+				ProjectsTemplate:         "gitlab.mvk.com/go/vkgo/projects/payments/%s",
+				AdditionalCommonPrefixes: []string{"gitlab.mvk.com/vkapi/vk-go-sdk-private"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cfg.RepoFor(tt.filename)
+			if err != nil {
+				t.Fatalf("RepoFor() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RepoFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if cfg.Repo.OrgPrefix != "github.com/myorg" {
+		t.Errorf("RepoFor() modified base config: %+v", cfg.Repo)
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	writeFile(t, filepath.Join(home, "goimporter", "config.yaml"), `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/other
+common_prefix: gitlab.mvk.com/go/other/pkg
+`)
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".git", "HEAD"), "ref: refs/heads/master\n")
+	writeFile(t, filepath.Join(root, ".goimporter.json"), `{
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "common_prefix": "gitlab.mvk.com/go/vkgo/pkg",
+  "domain_prefix": "gitlab.mvk.com/go/vkgo/projects/health/pkg"
+}`)
+	t.Setenv("GOIMPORTER_DOMAIN_PREFIX", "gitlab.mvk.com/go/vkgo/projects/payments/pkg")
+	t.Setenv("GOIMPORTER_PROJECTS_TEMPLATE", "gitlab.mvk.com/go/vkgo/projects/payments/%s")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := Parse(fs, []string{"-dir", root, "-projects-tpl", "gitlab.mvk.com/go/vkgo/services/%s"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got, err := cfg.Describe(root)
+	if err != nil {
+		t.Fatalf("Describe() error = %v", err)
+	}
+
+	want := []Setting{
+		{Key: "org_prefix", Value: "gitlab.mvk.com", Source: filepath.Join(home, "goimporter", "config.yaml")},
+		{Key: "repo_prefix", Value: "gitlab.mvk.com/go/vkgo", Source: filepath.Join(root, ".goimporter.json")},
+		{Key: "common_prefix", Value: "gitlab.mvk.com/go/vkgo/pkg", Source: filepath.Join(root, ".goimporter.json")},
+		{
+			Key:    "domain_prefix",
+			Value:  "gitlab.mvk.com/go/vkgo/projects/payments/pkg",
+			Source: "env GOIMPORTER_DOMAIN_PREFIX",
+		},
+		{Key: "projects_template", Value: "gitlab.mvk.com/go/vkgo/services/%s", Source: "flag -projects-tpl"},
+	}
+
+	// Keys that are not set anywhere keep their built-in defaults.
+	if len(got) != len(repoKeys()) {
+		t.Fatalf("Describe() returned %d settings, want %d", len(got), len(repoKeys()))
+	}
+	var configured []Setting
+	for _, setting := range got {
+		if setting.Source != defaultSource {
+			configured = append(configured, setting)
+		}
+	}
+	got = configured
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Describe() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeLists(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	writeFile(t, filepath.Join(home, "goimporter", "config.yaml"), `profile: vk
+additional_common_prefixes:
+  - gitlab.mvk.com/go/shared
+sections:
+  - [stdlib]
+  - [external, org_common]
+`)
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".git", "HEAD"), "ref: refs/heads/master\n")
+	writeFile(t, filepath.Join(root, ".goimporter.json"), `{
+  "additional_common_prefixes": ["gitlab.mvk.com/go/tools", "gitlab.mvk.com/go/shared"],
+  "sections": [["stdlib"], ["external"]]
+}`)
+
+	cfg, err := Parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-dir", root})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	got, err := cfg.RepoFor(filepath.Join(root, "app", "app.go"))
+	if err != nil {
+		t.Fatalf("RepoFor() error = %v", err)
+	}
+
+	// Lists of strings add up across layers and the profile; other values are replaced.
+	wantPrefixes := []string{"gitlab.mvk.com/go/shared", "gitlab.mvk.com/go/tools", "gitlab.mvk.com/vkapi/vk-go-sdk-private"}
+	if !reflect.DeepEqual(got.AdditionalCommonPrefixes, wantPrefixes) {
+		t.Errorf("AdditionalCommonPrefixes = %v, want %v", got.AdditionalCommonPrefixes, wantPrefixes)
+	}
+	wantSections := [][]string{{"stdlib"}, {"external"}}
+	if !reflect.DeepEqual(got.Sections, wantSections) {
+		t.Errorf("Sections = %v, want %v", got.Sections, wantSections)
+	}
+}
+
+func TestGlobalConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		xdg  bool
+	}{
+		{name: "XDG_CONFIG_HOME", xdg: true},
+		{name: "HOME fallback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			dir := filepath.Join(home, ".config")
+			if tt.xdg {
+				dir = filepath.Join(t.TempDir(), "xdg")
+				t.Setenv("XDG_CONFIG_HOME", dir)
+			} else {
+				t.Setenv("XDG_CONFIG_HOME", "")
+			}
+			path := filepath.Join(dir, "goimporter", "config.json")
+			writeFile(t, path, `{"profile": "vk"}`)
+
+			l, err := globalLayer()
+			if err != nil {
+				t.Fatalf("globalLayer() error = %v", err)
+			}
+			if l == nil || l.sources["profile"] != path || l.repo.Profile != "vk" {
+				t.Errorf("globalLayer() = %+v, want the profile from %s", l, path)
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantRepo    string
+		wantSource  string
+		wantSection [][]string
+	}{
+		{
+			name:       "vk profile presets the repository layout",
+			args:       []string{"-profile", "vk"},
+			wantRepo:   "gitlab.mvk.com/go/vkgo",
+			wantSource: "profile vk",
+		},
+		{
+			name:       "configured values override the profile",
+			args:       []string{"-profile", "vk", "-repo", "gitlab.mvk.com/go/vkgo"},
+			wantRepo:   "gitlab.mvk.com/go/vkgo",
+			wantSource: "flag -repo",
+		},
+		{
+			name:        "gci profile presets sections",
+			args:        []string{"-profile", "gci"},
+			wantRepo:    "github.com/myorg/myrepo",
+			wantSource:  "default",
+			wantSection: [][]string{{"stdlib"}, {"external"}, everythingElse[1:]},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(flag.NewFlagSet("test", flag.ContinueOnError), append(tt.args, "-discover=false"))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if cfg.Repo.RepoPrefix != tt.wantRepo {
+				t.Errorf("RepoPrefix = %q, want %q", cfg.Repo.RepoPrefix, tt.wantRepo)
+			}
+			if cfg.sources["repo_prefix"] != tt.wantSource {
+				t.Errorf("repo_prefix source = %q, want %q", cfg.sources["repo_prefix"], tt.wantSource)
+			}
+			if !reflect.DeepEqual(cfg.Repo.Sections, tt.wantSection) {
+				t.Errorf("Sections = %v, want %v", cfg.Repo.Sections, tt.wantSection)
+			}
+		})
+	}
+
+	_, err := Parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-profile", "google", "-discover=false"})
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "google"`) {
+		t.Errorf("Parse() error = %v, want unknown profile", err)
+	}
+}
+
+func TestDecodeConfigFile(t *testing.T) {
+	want := &entities.RepoConfig{
+		OrgPrefix:                "gitlab.mvk.com",
+		RepoPrefix:               "gitlab.mvk.com/go/vkgo",
+		CommonPrefix:             "github.com/myorg/myrepo/pkg",
+		AdditionalCommonPrefixes: []string{"gitlab.mvk.com/vkapi/vk-go-sdk-private"},
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "json",
+			file: "config.json",
+			content: `{
+  "org_prefix": "gitlab.mvk.com",
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "additional_common_prefixes": ["gitlab.mvk.com/vkapi/vk-go-sdk-private"]
+}`,
+		},
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `# VK settings.
+org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo # The monorepo.
+additional_common_prefixes:
+  - gitlab.mvk.com/vkapi/vk-go-sdk-private
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			content: `# VK settings.
+org_prefix = "gitlab.mvk.com"
+repo_prefix = "gitlab.mvk.com/go/vkgo" # The monorepo.
+additional_common_prefixes = ["gitlab.mvk.com/vkapi/vk-go-sdk-private"]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			writeFile(t, path, tt.content)
+
+			got := &entities.RepoConfig{
+				OrgPrefix:    "github.com/myorg",
+				CommonPrefix: "github.com/myorg/myrepo/pkg",
+			}
+			_, err := decodeConfigFile(path, got)
+			if err != nil {
+				t.Fatalf("decodeConfigFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decodeConfigFile() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{
+			name: "valid config",
+			file: "config.json",
+			content: `{
+  "$schema": "./schema.json",
+  "org_prefix": "gitlab.mvk.com",
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "common_prefix": "gitlab.mvk.com/go/vkgo/pkg",
+  "domain_prefix": "gitlab.mvk.com/go/vkgo/projects/health/pkg",
+  "projects_template": "gitlab.mvk.com/go/vkgo/projects/health/%s"
+}`,
+		},
+		{
+			name: "unknown key",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+comon_prefix: gitlab.mvk.com/go/vkgo/pkg
+`,
+			want: "config.yaml: comon_prefix: unknown key",
+		},
+		{
+			name: "unknown nested key json",
+			file: "config.json",
+			content: `{
+  "org_prefix": "gitlab.mvk.com",
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "alias_policy": {"no_redundent": true}
+}`,
+			want: `config.json: json: unknown field "no_redundent"`,
+		},
+		{
+			name: "unknown nested key yaml",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+alias_policy:
+  no_redundent: true
+`,
+			want: "config.yaml: yaml: unmarshal errors:\n  line 4: field no_redundent not found in type entities.AliasPolicy",
+		},
+		{
+			name: "unknown nested key toml",
+			file: "config.toml",
+			content: `org_prefix = "gitlab.mvk.com"
+repo_prefix = "gitlab.mvk.com/go/vkgo"
+
+[alias_policy]
+no_redundent = true
+`,
+			want: "config.toml: alias_policy.no_redundent: unknown key",
+		},
+		{
+			name: "unknown import kinds key",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+import_kinds:
+  grups: [blank]
+`,
+			want: "config.yaml: yaml: unmarshal errors:\n  line 4: field grups not found in type entities.KindRules",
+		},
+		{
+			name: "unknown architecture rule key",
+			file: "config.toml",
+			content: `org_prefix = "gitlab.mvk.com"
+repo_prefix = "gitlab.mvk.com/go/vkgo"
+
+[[architecture]]
+name = "pkg-independent"
+from = ["org_common"]
+deny = ["project"]
+
+[[architecture]]
+name = "no-sdk"
+from = ["project"]
+denny = ["gitlab.mvk.com/vkapi/..."]
+`,
+			want: "config.toml: architecture.denny: unknown key",
+		},
+		{
+			name: "unknown architecture rule key json",
+			file: "config.json",
+			content: `{
+  "org_prefix": "gitlab.mvk.com",
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "architecture": [{"name": "no-sdk", "from": ["project"], "denny": ["gitlab.mvk.com/vkapi/..."]}]
+}`,
+			want: `config.json: json: unknown field "denny"`,
+		},
+		{
+			name: "empty required keys",
+			file: "config.toml",
+			content: `org_prefix = ""
+repo_prefix = ""
+`,
+			want: "config.toml: org_prefix: required\n" +
+				"config.toml: repo_prefix: required",
+		},
+		{
+			name: "template without placeholder",
+			file: "config.json",
+			content: `{
+  "org_prefix": "gitlab.mvk.com",
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "projects_template": "gitlab.mvk.com/go/vkgo/projects/health"
+}`,
+			want: `config.json: projects_template: "gitlab.mvk.com/go/vkgo/projects/health" ` +
+				`has no %s or {project} placeholder for the project name`,
+		},
+		{
+			name: "unknown template placeholder",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+projects_templates:
+  - gitlab.mvk.com/go/vkgo/projects/{domain}/{project}
+  - gitlab.mvk.com/go/vkgo/services/{team}/{project}
+`,
+			want: `config.yaml: projects_templates: "gitlab.mvk.com/go/vkgo/services/{team}/{project}" ` +
+				`has unknown placeholder {team}, use {domain} or {project}`,
+		},
+		{
+			name: "unknown import kind",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+import_kinds:
+  groups: [blank, cgo]
+`,
+			want: `config.yaml: import_kinds: unknown import kind "cgo", available: blank, dot, named, plain`,
+		},
+		{
+			name: "import rule prefix without prefix replacement",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+import_rules:
+  - path: gitlab.mvk.com/go/vkgo/pkg/...
+    replacement: gitlab.mvk.com/go/vkgo/projects/health/pkg
+`,
+			want: `config.yaml: import_rules: replacement "gitlab.mvk.com/go/vkgo/projects/health/pkg" ` +
+				`of prefix "gitlab.mvk.com/go/vkgo/pkg/..." must end in /...`,
+		},
+		{
+			name: "unknown architecture selector",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+architecture:
+  - name: pkg-independent
+    from: [org_common]
+    deny: [internal]
+`,
+			want: `config.yaml: architecture: pkg-independent: unknown selector "internal", ` +
+				`use a group, "project" or an import path pattern`,
+		},
+		{
+			name: "pinned alias not an identifier",
+			file: "config.yaml",
+			content: `org_prefix: gitlab.mvk.com
+repo_prefix: gitlab.mvk.com/go/vkgo
+alias_policy:
+  pinned:
+    gitlab.mvk.com/go/vkgo/gen/user: user-pb
+`,
+			want: `config.yaml: alias_policy: pinned alias "user-pb" of "gitlab.mvk.com/go/vkgo/gen/user" is not an identifier`,
+		},
+		{
+			name: "inconsistent nesting",
+			file: "config.json",
+			content: `{
+  "org_prefix": "gitlab.mvk.com",
+  "repo_prefix": "gitlab.mvk.com/go/vkgo",
+  "domain_prefix": "github.com/myorg/myrepo/projects/domain/pkg"
+}`,
+			want: `config.json: domain_prefix: "github.com/myorg/myrepo/projects/domain/pkg" ` +
+				`is not inside repo_prefix "gitlab.mvk.com/go/vkgo"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, tt.file), tt.content)
+
+			err := ValidateFile(filepath.Join(dir, tt.file))
+			got := ""
+			if err != nil {
+				got = strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), "")
+			}
+			if got != tt.want {
+				t.Errorf("ValidateFile() error = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaCoversRepoConfig(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	err := json.Unmarshal(Schema(), &schema)
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	fields := reflect.TypeOf(entities.RepoConfig{})
+	for i := 0; i < fields.NumField(); i++ {
+		key := strings.Split(fields.Field(i).Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("schema is missing key %q", key)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
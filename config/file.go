@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"goimporter/entities"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// schema is the JSON Schema describing config files.
+//
+//go:embed schema.json
+var schema []byte
+
+// schemaKey is the key editors use to reference the schema; it is ignored when loading.
+const schemaKey = "$schema"
+
+// configFileNames lists the config file names discovered next to processed files.
+var configFileNames = []string{
+	".goimporter.json",
+	".goimporter.yaml",
+	".goimporter.yml",
+	".goimporter.toml",
+}
+
+// Schema returns the JSON Schema describing config files.
+func Schema() []byte {
+	return schema
+}
+
+// findConfigFile returns the first of the named config files in a directory,
+// or an empty string if there is none.
+func findConfigFile(dir string, names []string) string {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// fileConfig is the content of a config file: the repository configuration and the schema reference.
+type fileConfig struct {
+	*entities.RepoConfig `yaml:",inline"`
+
+	Schema any `json:"$schema" yaml:"$schema" toml:"$schema"`
+}
+
+// decodeConfigFile decodes a config file on top of the given configuration.
+// The format is chosen by extension. Keys missing from the file keep their current values,
+// unknown keys are rejected at every level. It returns the top-level keys set by the file.
+func decodeConfigFile(path string, repo *entities.RepoConfig) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading config file")
+	}
+
+	var (
+		keys   map[string]any
+		decode func(v any) error
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decode = func(v any) error {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			return dec.Decode(v)
+		}
+		err = json.Unmarshal(data, &keys)
+	case ".yaml", ".yml":
+		decode = func(v any) error {
+			dec := yaml.NewDecoder(bytes.NewReader(data))
+			dec.KnownFields(true)
+			err := dec.Decode(v)
+			if errors.Is(err, io.EOF) {
+				return nil // Empty file.
+			}
+			return err
+		}
+		err = yaml.Unmarshal(data, &keys)
+	case ".toml":
+		decode = func(v any) error {
+			md, err := toml.Decode(string(data), v)
+			if err != nil {
+				return err
+			}
+			var errs Errors
+			for _, key := range md.Undecoded() {
+				errs = append(errs, &Error{Source: path, Key: key.String(), Message: "unknown key"})
+			}
+			if len(errs) > 0 {
+				return errs
+			}
+			return nil
+		}
+		err = toml.Unmarshal(data, &keys)
+	default:
+		return nil, Errors{{Source: path, Message: "unsupported config format, use .json, .yaml, .yml or .toml"}}
+	}
+	if err != nil {
+		return nil, Errors{{Source: path, Message: err.Error()}}
+	}
+
+	// Reject unknown keys before decoding, so typos don't silently fall back to defaults.
+	known := knownKeys()
+	var set []string
+	var errs Errors
+	for key := range keys {
+		switch {
+		case key == schemaKey:
+		case !known[key]:
+			errs = append(errs, &Error{Source: path, Key: key, Message: "unknown key"})
+		default:
+			set = append(set, key)
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+		return nil, errs
+	}
+
+	// Nested keys are checked while decoding.
+	err = decode(&fileConfig{RepoConfig: repo})
+	var decodeErrs Errors
+	switch {
+	case errors.As(err, &decodeErrs):
+		return nil, decodeErrs
+	case err != nil:
+		return nil, Errors{{Source: path, Message: err.Error()}}
+	}
+
+	sort.Strings(set)
+	return set, nil
+}
+
+// knownKeys returns the set of config keys of the repository configuration.
+func knownKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range repoKeys() {
+		keys[key] = true
+	}
+	return keys
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"goimporter/entities"
+
+	"github.com/pkg/errors"
+)
+
+// globalConfigNames lists the global user config file names, looked up in the user config directory.
+var globalConfigNames = []string{
+	"config.json",
+	"config.yaml",
+	"config.yml",
+	"config.toml",
+}
+
+// defaultSource is the source of built-in default values.
+const defaultSource = "default"
+
+// repoSource is the source of values set with Config.SetRepo.
+const repoSource = "repository config"
+
+// layer is a partial repository configuration from a single source.
+type layer struct {
+	repo    *entities.RepoConfig // Values of the keys set by the layer.
+	keys    []string             // Keys set by the layer.
+	sources map[string]string    // Origin of each key, e.g. a file path or "flag -org".
+}
+
+// apply returns a copy of the configuration with the layer's keys overridden. Lists of strings,
+// such as additional_common_prefixes, are merged instead: the layer's entries are added to the
+// entries of the layers below.
+func (l *layer) apply(r *resolved) *resolved {
+	out := &resolved{
+		repo:    r.repo.Clone(),
+		sources: make(map[string]string, len(r.sources)+len(l.keys)),
+	}
+	for key, source := range r.sources {
+		out.sources[key] = source
+	}
+
+	src := reflect.ValueOf(l.repo.Clone()).Elem()
+	dst := reflect.ValueOf(out.repo).Elem()
+	for _, key := range l.keys {
+		field := dst.FieldByIndex(keyField(key).Index)
+		value := src.FieldByIndex(keyField(key).Index)
+		if mergedKey(key) {
+			value = reflect.ValueOf(mergeStrings(field.Interface().([]string), value.Interface().([]string)))
+		}
+		field.Set(value)
+		out.sources[key] = l.sources[key]
+	}
+	return out
+}
+
+// mergedKey reports whether a key's values are merged across layers, which is the case for lists
+// of strings.
+func mergedKey(key string) bool {
+	return keyField(key).Type == reflect.TypeOf([]string(nil))
+}
+
+// mergeStrings returns the entries of base followed by those of add that base doesn't have.
+func mergeStrings(base, add []string) []string {
+	if len(base) == 0 {
+		return add
+	}
+	merged := append([]string(nil), base...)
+	for _, s := range add {
+		if !slices.Contains(merged, s) {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// defaultLayer returns the built-in defaults for every key.
+func defaultLayer() *layer {
+	l := &layer{repo: DefaultRepoConfig(), sources: make(map[string]string)}
+	for _, key := range repoKeys() {
+		l.keys = append(l.keys, key)
+		l.sources[key] = defaultSource
+	}
+	return l
+}
+
+// globalLayer loads the global user config, e.g. ~/.config/goimporter/config.yaml.
+// It returns nil if there is none.
+func globalLayer() (*layer, error) {
+	dir := globalConfigDir()
+	if dir == "" {
+		return nil, nil
+	}
+
+	path := findConfigFile(dir, globalConfigNames)
+	if path == "" {
+		return nil, nil
+	}
+	return fileLayer(path)
+}
+
+// globalConfigDir returns the directory of the global user config: $XDG_CONFIG_HOME/goimporter,
+// or ~/.config/goimporter on every OS, the location install scripts write to. It returns an
+// empty string if neither variable is set.
+func globalConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "goimporter")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "goimporter")
+}
+
+// fileLayer loads the keys set by a config file.
+func fileLayer(path string) (*layer, error) {
+	l := &layer{repo: &entities.RepoConfig{}, sources: make(map[string]string)}
+
+	keys, err := decodeConfigFile(path, l.repo)
+	if err != nil {
+		return nil, err
+	}
+
+	l.keys = keys
+	for _, key := range keys {
+		l.sources[key] = path
+	}
+	return l, nil
+}
+
+// envLayer loads the keys set by GOIMPORTER_* environment variables.
+func envLayer() (*layer, error) {
+	l := &layer{repo: &entities.RepoConfig{}, sources: make(map[string]string)}
+
+	for _, key := range repoKeys() {
+		name := envPrefix + strings.ToUpper(key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		err := setKey(l.repo, key, value)
+		if err != nil {
+			return nil, &Error{Source: "env " + name, Key: key, Message: err.Error()}
+		}
+		l.keys = append(l.keys, key)
+		l.sources[key] = "env " + name
+	}
+	return l, nil
+}
+
+// flagLayer loads the keys set by explicitly given flags.
+func flagLayer(fs *flag.FlagSet) (*layer, error) {
+	l := &layer{repo: &entities.RepoConfig{}, sources: make(map[string]string)}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, rf := range repoFlags {
+			if rf.name != f.Name || err != nil {
+				continue
+			}
+
+			err = setKey(l.repo, rf.key, f.Value.String())
+			if err != nil {
+				err = &Error{Source: "flag -" + f.Name, Key: rf.key, Message: err.Error()}
+				return
+			}
+			l.keys = append(l.keys, rf.key)
+			l.sources[rf.key] = "flag -" + f.Name
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// repoKeys returns the config keys of the repository configuration, in declaration order.
+func repoKeys() []string {
+	var keys []string
+	fields := reflect.TypeOf(entities.RepoConfig{})
+	for i := 0; i < fields.NumField(); i++ {
+		if key := tagKey(fields.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// keyField returns the repository configuration field of a config key.
+func keyField(key string) reflect.StructField {
+	fields := reflect.TypeOf(entities.RepoConfig{})
+	for i := 0; i < fields.NumField(); i++ {
+		if tagKey(fields.Field(i)) == key {
+			return fields.Field(i)
+		}
+	}
+	panic("unknown config key " + key)
+}
+
+// tagKey returns the config key of a field, or an empty string if it has none.
+func tagKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("json"), ",")[0]
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// setKey sets a config key from its string form; lists of strings are comma-separated,
+// other structured values are JSON.
+func setKey(repo *entities.RepoConfig, key, value string) error {
+	field := reflect.ValueOf(repo).Elem().FieldByIndex(keyField(key).Index)
+
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		// Structured values are given as JSON.
+		ptr := reflect.New(field.Type())
+		err := json.Unmarshal([]byte(value), ptr.Interface())
+		if err != nil {
+			return errors.Wrap(err, "parsing JSON value")
+		}
+		field.Set(ptr.Elem())
+	}
+	return nil
+}
+
+// formatKey returns the string form of a config key, as accepted by setKey.
+func formatKey(repo *entities.RepoConfig, key string) string {
+	field := reflect.ValueOf(repo).Elem().FieldByIndex(keyField(key).Index)
+
+	switch {
+	case field.Kind() == reflect.String:
+		return field.String()
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		return strings.Join(field.Interface().([]string), ",")
+	case field.IsZero():
+		return ""
+	default:
+		data, _ := json.Marshal(field.Interface())
+		return string(data)
+	}
+}
+
+// Setting is a single effective config value together with where it came from.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Describe returns the effective configuration for files in a directory, key by key.
+func (c *Config) Describe(dir string) ([]Setting, error) {
+	r, err := c.resolveDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make([]Setting, 0, len(repoKeys()))
+	for _, key := range repoKeys() {
+		settings = append(settings, Setting{
+			Key:    key,
+			Value:  formatKey(r.repo, key),
+			Source: r.sources[key],
+		})
+	}
+	return settings, nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+
+	"goimporter/entities"
+)
+
+// profileSource prefixes the source of values preset by a profile.
+const profileSource = "profile "
+
+// everythingElse lists all groups except the standard library.
+var everythingElse = []string{
+	entities.GroupExternal,
+	entities.GroupOrgCommon,
+	entities.GroupDomainCommon,
+	entities.GroupRepoOther,
+	entities.GroupSiblingProject,
+	entities.GroupProjectPkg,
+	entities.GroupProjectInternal,
+}
+
+// profiles holds the built-in named profiles. Values set by a profile replace
+// the built-in defaults but are overridden by any configured value, except lists, which are merged.
+var profiles = map[string]struct {
+	description string
+	repo        *entities.RepoConfig
+}{
+	"default": {
+		description: "One section per group: stdlib, external, org, domain, repo, sibling project, project pkg, project internal",
+		repo:        &entities.RepoConfig{},
+	},
+	"goimports": {
+		description: "Standard library, then everything else",
+		repo: &entities.RepoConfig{
+			Sections: [][]string{{entities.GroupStdlib}, everythingElse},
+		},
+	},
+	"gci": {
+		description: "gci standard, default and prefix(org_prefix) sections",
+		repo: &entities.RepoConfig{
+			Sections: [][]string{
+				{entities.GroupStdlib},
+				{entities.GroupExternal},
+				everythingElse[1:],
+			},
+		},
+	},
+	"uber": {
+		description: "Uber Go Style Guide: standard library, then everything else",
+		repo: &entities.RepoConfig{
+			Sections: [][]string{{entities.GroupStdlib}, everythingElse},
+		},
+	},
+	"vk": {
+		description: "VK monorepo layout of gitlab.mvk.com/go/vkgo with the health domain",
+		repo: &entities.RepoConfig{
+			OrgPrefix:        "gitlab.mvk.com",
+			RepoPrefix:       "gitlab.mvk.com/go/vkgo",
+			CommonPrefix:     "gitlab.mvk.com/go/vkgo/pkg",
+			DomainPrefix:     "gitlab.mvk.com/go/vkgo/projects/health/pkg",
+			ProjectsTemplate: "gitlab.mvk.com/go/vkgo/projects/health/%s",
+			AdditionalCommonPrefixes: []string{
+				"gitlab.mvk.com/vkapi/vk-go-sdk-private",
+			},
+		},
+	},
+}
+
+// Profile describes a built-in named profile.
+type Profile struct {
+	Name        string
+	Description string
+}
+
+// Profiles returns the built-in profiles sorted by name.
+func Profiles() []Profile {
+	list := make([]Profile, 0, len(profiles))
+	for name, p := range profiles {
+		list = append(list, Profile{Name: name, Description: p.description})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// applyProfile presets the values of the selected profile for keys still at their built-in defaults,
+// and adds the profile's entries to configured lists.
+// Unknown profiles are left to validation.
+func applyProfile(r *resolved) *resolved {
+	p, ok := profiles[r.repo.Profile]
+	if !ok {
+		return r
+	}
+
+	l := &layer{repo: p.repo, sources: make(map[string]string)}
+	values := reflect.ValueOf(p.repo).Elem()
+	for _, key := range repoKeys() {
+		if values.FieldByIndex(keyField(key).Index).IsZero() {
+			continue
+		}
+		switch {
+		case r.sources[key] == defaultSource:
+			l.sources[key] = profileSource + r.repo.Profile
+		case mergedKey(key):
+			// Configured lists add to the profile's, and errors in them still name their source.
+			l.sources[key] = r.sources[key]
+		default:
+			continue
+		}
+		l.keys = append(l.keys, key)
+	}
+	return l.apply(r)
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"go/token"
+	"maps"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"goimporter/entities"
+)
+
+// Error describes a single problem with a configuration.
+type Error struct {
+	Source  string // Config file or other source the value came from, e.g. "flag -org".
+	Key     string // Offending key, empty if the whole file is invalid.
+	Message string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	var parts []string
+	if e.Source != "" {
+		parts = append(parts, e.Source)
+	}
+	if e.Key != "" {
+		parts = append(parts, e.Key)
+	}
+	return strings.Join(append(parts, e.Message), ": ")
+}
+
+// Errors collects all problems found in a configuration.
+type Errors []*Error
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks a repository configuration for missing and inconsistent values.
+func Validate(repo *entities.RepoConfig) error {
+	return validate(repo, nil)
+}
+
+// ValidateFile loads a config file strictly and validates it merged on top of the defaults.
+// Discovered files (.goimporter.*) are also merged with the config files of their parent directories.
+func ValidateFile(path string) error {
+	cfg := &Config{
+		Discover: true,
+		base:     defaultLayer().apply(&resolved{repo: &entities.RepoConfig{}}),
+	}
+	if slices.Contains(configFileNames, filepath.Base(path)) {
+		_, err := cfg.RepoForDir(filepath.Dir(path))
+		return err
+	}
+
+	l, err := fileLayer(path)
+	if err != nil {
+		return err
+	}
+
+	r := l.apply(cfg.base)
+	return validate(r.repo, r.sources)
+}
+
+// validate checks a repository configuration, attributing problems to the files in sources.
+func validate(repo *entities.RepoConfig, sources map[string]string) error {
+	// Built-in defaults are placeholders that never match a real repository,
+	// so only configured values are reported.
+	var errs Errors
+	report := func(key, format string, args ...any) {
+		if sources[key] == defaultSource {
+			return
+		}
+		errs = append(errs, &Error{Source: sources[key], Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Required keys.
+	if repo.OrgPrefix == "" {
+		report("org_prefix", "required")
+	}
+	if repo.RepoPrefix == "" {
+		report("repo_prefix", "required")
+	}
+
+	// Prefixes must be nested consistently, otherwise classification falls through to the wrong group.
+	if repo.OrgPrefix != "" && repo.RepoPrefix != "" && !isWithin(repo.RepoPrefix, repo.OrgPrefix) {
+		report("repo_prefix", "%q is not inside org_prefix %q", repo.RepoPrefix, repo.OrgPrefix)
+	}
+	if repo.OrgPrefix != "" && repo.CommonPrefix != "" && !isWithin(repo.CommonPrefix, repo.OrgPrefix) {
+		report("common_prefix", "%q is not inside org_prefix %q", repo.CommonPrefix, repo.OrgPrefix)
+	}
+	if repo.RepoPrefix != "" && repo.DomainPrefix != "" && !isWithin(repo.DomainPrefix, repo.RepoPrefix) {
+		report("domain_prefix", "%q is not inside repo_prefix %q", repo.DomainPrefix, repo.RepoPrefix)
+	}
+	for _, prefix := range repo.AdditionalCommonPrefixes {
+		switch {
+		case prefix == "":
+			report("additional_common_prefixes", "empty prefix")
+		case repo.OrgPrefix != "" && !isWithin(prefix, repo.OrgPrefix):
+			report("additional_common_prefixes", "%q is not inside org_prefix %q", prefix, repo.OrgPrefix)
+		}
+	}
+
+	// Project layout templates.
+	if repo.ProjectsTemplate != "" {
+		validateTemplate(repo, "projects_template", repo.ProjectsTemplate, report)
+	}
+	for _, tpl := range repo.ProjectsTemplates {
+		validateTemplate(repo, "projects_templates", tpl, report)
+	}
+
+	if _, ok := profiles[repo.Profile]; repo.Profile != "" && !ok {
+		var names []string
+		for _, p := range Profiles() {
+			names = append(names, p.Name)
+		}
+		report("profile", "unknown profile %q, available: %s", repo.Profile, strings.Join(names, ", "))
+	}
+
+	// Sections must reference each known group at most once.
+	seen := make(map[string]bool)
+	for _, section := range repo.Sections {
+		if len(section) == 0 {
+			report("sections", "empty section")
+		}
+		for _, name := range section {
+			switch {
+			case !slices.Contains(entities.GroupNames, name):
+				report("sections", "unknown group %q, available: %s", name, strings.Join(entities.GroupNames, ", "))
+			case seen[name]:
+				report("sections", "group %q is listed more than once", name)
+			}
+			seen[name] = true
+		}
+	}
+
+	switch repo.ReplaceGrouping {
+	case "", entities.ReplaceGroupingOriginal, entities.ReplaceGroupingLocal, entities.ReplaceGroupingOrg:
+	default:
+		report("replace_grouping", "%q must be one of %q, %q or %q", repo.ReplaceGrouping,
+			entities.ReplaceGroupingOriginal, entities.ReplaceGroupingLocal, entities.ReplaceGroupingOrg)
+	}
+
+	for _, marker := range repo.GeneratedMarkers {
+		if strings.TrimSpace(marker) == "" {
+			report("generated_markers", "empty marker")
+		}
+	}
+	for _, generator := range repo.IncludeGenerated {
+		if strings.TrimSpace(generator) == "" {
+			report("include_generated", "empty generator")
+		}
+	}
+	if suffix := repo.AliasPolicy.ProtobufSuffix; suffix != "" && !token.IsIdentifier("x"+suffix) {
+		report("alias_policy", "protobuf_suffix %q is not valid in an identifier", suffix)
+	}
+	for _, alias := range repo.AliasPolicy.Forbidden {
+		if !token.IsIdentifier(alias) {
+			report("alias_policy", "forbidden alias %q is not an identifier", alias)
+		}
+	}
+	for _, importPath := range slices.Sorted(maps.Keys(repo.AliasPolicy.Pinned)) {
+		alias := repo.AliasPolicy.Pinned[importPath]
+		switch {
+		case importPath == "":
+			report("alias_policy", "pinned alias %q has an empty import path", alias)
+		case !token.IsIdentifier(alias):
+			report("alias_policy", "pinned alias %q of %q is not an identifier", alias, importPath)
+		case slices.Contains(repo.AliasPolicy.Forbidden, alias):
+			report("alias_policy", "pinned alias %q of %q is forbidden", alias, importPath)
+		}
+	}
+	kinds := make(map[string]bool)
+	for _, kind := range repo.ImportKinds.Groups {
+		switch {
+		case !slices.Contains(entities.ImportKinds, kind):
+			report("import_kinds", "unknown import kind %q, available: %s", kind, strings.Join(entities.ImportKinds, ", "))
+		case kinds[kind]:
+			report("import_kinds", "import kind %q is listed more than once", kind)
+		}
+		kinds[kind] = true
+	}
+	for _, rule := range repo.ImportRules {
+		validateImportRule(rule, report)
+	}
+	for _, rule := range repo.Architecture {
+		validateArchRule(rule, report)
+	}
+	for _, glob := range repo.GeneratedGlobs {
+		if _, err := path.Match(glob, ""); glob == "" || err != nil {
+			report("generated_globs", "invalid glob %q", glob)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateImportRule checks a banned or deprecated import rule: prefix rules need a prefix replacement
+// and can't replace selectors, which must name an identifier of an import path.
+func validateImportRule(rule entities.ImportRule, report func(key, format string, args ...any)) {
+	prefix := strings.HasSuffix(rule.Path, "/...")
+	switch {
+	case rule.Path == "" || rule.Path == "/...":
+		report("import_rules", "empty path")
+	case prefix && rule.Replacement != "" && !strings.HasSuffix(rule.Replacement, "/..."):
+		report("import_rules", "replacement %q of prefix %q must end in /...", rule.Replacement, rule.Path)
+	case !prefix && strings.HasSuffix(rule.Replacement, "/..."):
+		report("import_rules", "replacement %q of path %q must not end in /...", rule.Replacement, rule.Path)
+	case prefix && len(rule.Selectors) > 0:
+		report("import_rules", "prefix %q can't replace selectors", rule.Path)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(rule.Selectors)) {
+		target := rule.Selectors[name]
+		i := strings.LastIndex(target, ".")
+		if !token.IsIdentifier(name) || i <= 0 || !token.IsIdentifier(target[i+1:]) {
+			report("import_rules", "selector replacement %s: %q of %q must map a name to path.Name", name, target, rule.Path)
+		}
+	}
+}
+
+// validateArchRule checks an architecture rule: it needs packages to apply to and imports to deny,
+// selected by known groups, "project" or valid import path patterns.
+func validateArchRule(rule entities.ArchRule, report func(key, format string, args ...any)) {
+	name := rule.Name
+	if name == "" {
+		name = "unnamed rule"
+	}
+	if len(rule.From) == 0 {
+		report("architecture", "%s: no from packages", name)
+	}
+	if len(rule.Deny) == 0 {
+		report("architecture", "%s: no denied imports", name)
+	}
+
+	for _, selector := range slices.Concat(rule.From, rule.Deny, rule.Allow) {
+		switch {
+		case strings.ContainsAny(selector, "./"):
+			base := strings.TrimSuffix(selector, "/...")
+			if _, err := path.Match(base, ""); err != nil || base == "" {
+				report("architecture", "%s: invalid import path pattern %q", name, selector)
+			}
+		case selector != "project" && !slices.Contains(entities.PathGroupNames, selector):
+			report("architecture", "%s: unknown selector %q, use a group, \"project\" or an import path pattern", name, selector)
+		}
+	}
+}
+
+// templatePlaceholder matches the placeholders of a project layout template.
+var templatePlaceholder = regexp.MustCompile(`%s|\{[^}]*\}`)
+
+// validateTemplate checks a project layout template: it needs exactly one project placeholder
+// ({project} or %s), at most one {domain}, and must lie inside repo_prefix.
+func validateTemplate(repo *entities.RepoConfig, key, tpl string, report func(key, format string, args ...any)) {
+	projects, domains := 0, 0
+	for _, placeholder := range templatePlaceholder.FindAllString(tpl, -1) {
+		switch placeholder {
+		case "%s", "{project}":
+			projects++
+		case "{domain}":
+			domains++
+		default:
+			report(key, "%q has unknown placeholder %s, use {domain} or {project}", tpl, placeholder)
+		}
+	}
+
+	prefix := strings.TrimSuffix(tpl[:indexOrLen(tpl, templatePlaceholder)], "/")
+	switch {
+	case projects == 0:
+		report(key, "%q has no %%s or {project} placeholder for the project name", tpl)
+	case projects > 1:
+		report(key, "%q has more than one project placeholder", tpl)
+	case domains > 1:
+		report(key, "%q has more than one {domain} placeholder", tpl)
+	case repo.RepoPrefix != "" && !isWithin(prefix, repo.RepoPrefix):
+		report(key, "%q is not inside repo_prefix %q", tpl, repo.RepoPrefix)
+	}
+}
+
+// indexOrLen returns the index of the first match of re in s, or the length of s if there is none.
+func indexOrLen(s string, re *regexp.Regexp) int {
+	if loc := re.FindStringIndex(s); loc != nil {
+		return loc[0]
+	}
+	return len(s)
+}
+
+// isWithin checks if an import path equals a prefix or lies below it.
+func isWithin(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
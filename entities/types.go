@@ -1,9 +1,42 @@
 package entities
 
+import (
+	"maps"
+	"slices"
+	"strconv"
+)
+
 // Import represents a single import statement.
 type Import struct {
-	Alias string
-	Path  string
+	Alias   string
+	Path    string
+	Doc     string // Comment lines directly above the import, newline-separated.
+	Comment string // Trailing comment on the import line.
+}
+
+// Import kinds, matched by import kind rules.
+const (
+	KindBlank = "blank" // Blank imports for side effects, e.g. _ "embed".
+	KindDot   = "dot"   // Dot imports, e.g. . "testing".
+	KindNamed = "named" // Imports with an alias.
+	KindPlain = "plain" // Imports without an alias.
+)
+
+// ImportKinds lists the import kinds.
+var ImportKinds = []string{KindBlank, KindDot, KindNamed, KindPlain}
+
+// Kind returns the kind of the import.
+func (i Import) Kind() string {
+	switch i.Alias {
+	case "_":
+		return KindBlank
+	case ".":
+		return KindDot
+	case "":
+		return KindPlain
+	default:
+		return KindNamed
+	}
 }
 
 // ImportGroups organizes imports into logical groups.
@@ -13,27 +46,365 @@ type ImportGroups struct {
 	OrgCommon       []Import // Common organization packages.
 	DomainCommon    []Import // Domain packages.
 	RepoOther       []Import // Other repository packages.
+	SiblingProject  []Import // Packages of other projects in the repository.
 	ProjectPkg      []Import // Project-specific pkg packages.
 	ProjectInternal []Import // Project-specific internal packages.
+	Named           []Import // Imports with an alias, if grouped by kind.
+	Plain           []Import // Imports without an alias, if grouped by kind.
+	Dot             []Import // Dot imports, if grouped by kind.
+	Blank           []Import // Blank imports, if grouped by kind.
+}
+
+// Import group names, used to lay out sections.
+const (
+	GroupStdlib          = "stdlib"
+	GroupExternal        = "external"
+	GroupOrgCommon       = "org_common"
+	GroupDomainCommon    = "domain_common"
+	GroupRepoOther       = "repo_other"
+	GroupSiblingProject  = "sibling_project"
+	GroupProjectPkg      = "project_pkg"
+	GroupProjectInternal = "project_internal"
+	GroupNamed           = KindNamed
+	GroupPlain           = KindPlain
+	GroupDot             = KindDot
+	GroupBlank           = KindBlank
+)
+
+// PathGroupNames lists the groups imports are classified into by path, in their default order.
+var PathGroupNames = []string{
+	GroupStdlib,
+	GroupExternal,
+	GroupOrgCommon,
+	GroupDomainCommon,
+	GroupRepoOther,
+	GroupSiblingProject,
+	GroupProjectPkg,
+	GroupProjectInternal,
+}
+
+// GroupNames lists the import groups in their default order: the path groups, then the import kind groups.
+var GroupNames = slices.Concat(PathGroupNames, []string{GroupNamed, GroupPlain, GroupDot, GroupBlank})
+
+// Group returns the imports of a group by name.
+func (g *ImportGroups) Group(name string) []Import {
+	if group := g.group(name); group != nil {
+		return *group
+	}
+	return nil
+}
+
+// group returns the slice holding the imports of a group by name, nil for unknown groups.
+func (g *ImportGroups) group(name string) *[]Import {
+	switch name {
+	case GroupStdlib:
+		return &g.Stdlib
+	case GroupExternal:
+		return &g.External
+	case GroupOrgCommon:
+		return &g.OrgCommon
+	case GroupDomainCommon:
+		return &g.DomainCommon
+	case GroupRepoOther:
+		return &g.RepoOther
+	case GroupSiblingProject:
+		return &g.SiblingProject
+	case GroupProjectPkg:
+		return &g.ProjectPkg
+	case GroupProjectInternal:
+		return &g.ProjectInternal
+	case GroupNamed:
+		return &g.Named
+	case GroupPlain:
+		return &g.Plain
+	case GroupDot:
+		return &g.Dot
+	case GroupBlank:
+		return &g.Blank
+	default:
+		return nil
+	}
+}
+
+// Add appends an import to a group by name. Imports of unknown groups are dropped.
+func (g *ImportGroups) Add(name string, imp Import) {
+	if group := g.group(name); group != nil {
+		*group = append(*group, imp)
+	}
 }
 
 // RepoConfig holds organization and repository configuration.
 type RepoConfig struct {
 	// Organization prefix (e.g. "github.com/myorg").
-	OrgPrefix string `json:"org_prefix"`
+	OrgPrefix string `json:"org_prefix" yaml:"org_prefix" toml:"org_prefix"`
 
 	// Repository prefix (e.g. "github.com/myorg/myrepo").
-	RepoPrefix string `json:"repo_prefix"`
+	RepoPrefix string `json:"repo_prefix" yaml:"repo_prefix" toml:"repo_prefix"`
 
 	// Common packages prefix (e.g. "github.com/myorg/myrepo/pkg").
-	CommonPrefix string `json:"common_prefix"`
+	CommonPrefix string `json:"common_prefix" yaml:"common_prefix" toml:"common_prefix"`
 
 	// Domain-specific packages prefix (e.g. "github.com/myorg/myrepo/projects/domain/pkg").
-	DomainPrefix string `json:"domain_prefix"`
+	DomainPrefix string `json:"domain_prefix" yaml:"domain_prefix" toml:"domain_prefix"`
 
 	// Projects template for project-specific imports (e.g. "github.com/myorg/myrepo/projects/domain/%s").
-	ProjectsTemplate string `json:"projects_template"`
+	ProjectsTemplate string `json:"projects_template" yaml:"projects_template" toml:"projects_template"`
+
+	// Additional project layout templates with {domain} and {project} placeholders
+	// (e.g. "github.com/myorg/myrepo/projects/{domain}/{project}" or "github.com/myorg/myrepo/services/{project}").
+	ProjectsTemplates []string `json:"projects_templates" yaml:"projects_templates" toml:"projects_templates"`
 
 	// Additional special repository prefixes that should be grouped with common packages.
-	AdditionalCommonPrefixes []string `json:"additional_common_prefixes"`
+	AdditionalCommonPrefixes []string `json:"additional_common_prefixes" yaml:"additional_common_prefixes" toml:"additional_common_prefixes"`
+
+	// Named profile with preset values for keys that are not configured otherwise (e.g. "gci").
+	Profile string `json:"profile" yaml:"profile" toml:"profile"`
+
+	// Import sections in output order, each listing the groups merged into it.
+	// Groups not listed are added to the last section. Empty means one section per group.
+	Sections [][]string `json:"sections" yaml:"sections" toml:"sections"`
+
+	// Grouping of modules replaced in go.mod: "original" (default), "local" or "org".
+	ReplaceGrouping string `json:"replace_grouping" yaml:"replace_grouping" toml:"replace_grouping"`
+
+	// Additional case-insensitive markers of generated files, looked up in comments before the package clause
+	// (e.g. "by mockgen"). Files following the "// Code generated ... DO NOT EDIT." convention are always detected.
+	GeneratedMarkers []string `json:"generated_markers" yaml:"generated_markers" toml:"generated_markers"`
+
+	// Globs of generated files, matched against the file name or, with slashes, trailing path elements
+	// (e.g. "*.pb.go" or "zz_generated*.go").
+	GeneratedGlobs []string `json:"generated_globs" yaml:"generated_globs" toml:"generated_globs"`
+
+	// Generators whose output is formatted anyway, matched case-insensitively against the generator
+	// of a "// Code generated by <generator> ... DO NOT EDIT." comment (e.g. "mockgen" or "sqlc").
+	IncludeGenerated []string `json:"include_generated" yaml:"include_generated" toml:"include_generated"`
+
+	// Import alias conventions, reported in check mode and applied with -fix.
+	AliasPolicy AliasPolicy `json:"alias_policy" yaml:"alias_policy" toml:"alias_policy"`
+
+	// Placement and check rules by import kind.
+	ImportKinds KindRules `json:"import_kinds" yaml:"import_kinds" toml:"import_kinds"`
+
+	// Banned and deprecated imports, reported in check mode. Deprecated imports are replaced with -fix.
+	ImportRules []ImportRule `json:"import_rules" yaml:"import_rules" toml:"import_rules"`
+
+	// Architecture rules restricting which packages may import which, reported in check mode.
+	Architecture []ArchRule `json:"architecture" yaml:"architecture" toml:"architecture"`
+}
+
+// ImportRule bans or deprecates an import path. Rules without a replacement ban the import.
+type ImportRule struct {
+	// Import path, or a prefix if it ends in "/..." (e.g. "github.com/pkg/errors" or "gitlab.mvk.com/go/old/...").
+	Path string `json:"path" yaml:"path" toml:"path"`
+
+	// Reason reported with violations.
+	Message string `json:"message" yaml:"message" toml:"message"`
+
+	// Import path replacing a deprecated import, ending in "/..." for prefixes (e.g. "errors").
+	Replacement string `json:"replacement" yaml:"replacement" toml:"replacement"`
+
+	// Replacements of selected names of a deprecated import, as "path.Name"
+	// (e.g. {"ReadFile": "os.ReadFile", "ReadAll": "io.ReadAll"} for io/ioutil).
+	Selectors map[string]string `json:"selectors" yaml:"selectors" toml:"selectors"`
+}
+
+// ArchRule forbids the packages in some locations from importing some packages.
+// Packages are selected by the group they are classified into relative to the file's project
+// (e.g. "domain_common"), by "project" for the packages of any project, or by import path patterns
+// where * matches one path element and a trailing "/..." any packages below
+// (e.g. "github.com/myorg/myrepo/projects/*/internal/...").
+type ArchRule struct {
+	// Name of the rule, reported with violations (e.g. "pkg-independent").
+	Name string `json:"name" yaml:"name" toml:"name"`
+
+	// Packages the rule applies to, selected by the location of the file.
+	From []string `json:"from" yaml:"from" toml:"from"`
+
+	// Imports the packages must not have.
+	Deny []string `json:"deny" yaml:"deny" toml:"deny"`
+
+	// Imports allowed even though denied.
+	Allow []string `json:"allow" yaml:"allow" toml:"allow"`
+
+	// Reason reported with violations.
+	Message string `json:"message" yaml:"message" toml:"message"`
+}
+
+// Deprecated checks if the rule has a replacement, rather than banning the import.
+func (r ImportRule) Deprecated() bool {
+	return r.Replacement != "" || len(r.Selectors) > 0
+}
+
+// KindRules holds the rules for imports by kind (blank, dot, named or plain).
+type KindRules struct {
+	// Kinds placed in their own group instead of by path (e.g. ["blank", "dot"]).
+	// The groups are named after the kinds and trail the other groups unless laid out in sections.
+	Groups []string `json:"groups" yaml:"groups" toml:"groups"`
+
+	// Require a justification comment on blank imports, above the import or after it on the same line.
+	RequireBlankComment bool `json:"require_blank_comment" yaml:"require_blank_comment" toml:"require_blank_comment"`
+
+	// Forbid dot imports outside _test.go files.
+	NoDotImports bool `json:"no_dot_imports" yaml:"no_dot_imports" toml:"no_dot_imports"`
+}
+
+// AliasPolicy holds the import alias conventions of a repository.
+type AliasPolicy struct {
+	// Required suffix of the names protobuf packages are imported as (e.g. "pb" for userpb).
+	// Packages with *.pb.go files are protobuf packages.
+	ProtobufSuffix string `json:"protobuf_suffix" yaml:"protobuf_suffix" toml:"protobuf_suffix"`
+
+	// Require aliases for versioned import paths, such as ".../v2" or "gopkg.in/yaml.v3".
+	VersionedAlias bool `json:"versioned_alias" yaml:"versioned_alias" toml:"versioned_alias"`
+
+	// Forbid aliases that just repeat the package name.
+	NoRedundant bool `json:"no_redundant" yaml:"no_redundant" toml:"no_redundant"`
+
+	// Forbidden aliases.
+	Forbidden []string `json:"forbidden" yaml:"forbidden" toml:"forbidden"`
+
+	// Aliases pinned for import paths (e.g. {"github.com/myorg/myrepo/gen/user": "userpb"}).
+	Pinned map[string]string `json:"pinned" yaml:"pinned" toml:"pinned"`
+
+	// Require every import path to be imported by the same name across the processed files:
+	// its pinned alias, or else the name most files import it by.
+	Consistent bool `json:"consistent" yaml:"consistent" toml:"consistent"`
+}
+
+// Project describes the project an import path belongs to.
+type Project struct {
+	Domain string // Domain name, empty if the layout has no domain.
+	Name   string // Project name.
+	Root   string // Import path of the project root.
+}
+
+// Replace grouping modes for modules replaced in go.mod.
+const (
+	// ReplaceGroupingOriginal keeps the group of the original import path.
+	ReplaceGroupingOriginal = "original"
+	// ReplaceGroupingLocal groups replaced modules with other repository packages.
+	ReplaceGroupingLocal = "local"
+	// ReplaceGroupingOrg groups replaced modules with common organization packages.
+	ReplaceGroupingOrg = "org"
+)
+
+// Module describes the Go module a file belongs to.
+type Module struct {
+	Path     string    // Module path from the module directive.
+	Dir      string    // Directory containing go.mod.
+	Replaces []Replace // Replace directives.
+	Requires []Require // Required modules.
+}
+
+// Require is a single go.mod require directive.
+type Require struct {
+	Path    string // Required module path.
+	Version string // Required version.
+}
+
+// Replace is a single go.mod replace directive.
+type Replace struct {
+	Old        string // Replaced module path.
+	New        string // Replacement module path or local directory.
+	NewVersion string // Version of the replacement module, empty for local directories.
+	Local      bool   // Whether the replacement is a local directory.
+}
+
+// Clone returns a deep copy of the repository configuration.
+func (r *RepoConfig) Clone() *RepoConfig {
+	clone := *r
+	clone.ProjectsTemplates = append([]string(nil), r.ProjectsTemplates...)
+	clone.AdditionalCommonPrefixes = append([]string(nil), r.AdditionalCommonPrefixes...)
+	clone.GeneratedMarkers = append([]string(nil), r.GeneratedMarkers...)
+	clone.GeneratedGlobs = append([]string(nil), r.GeneratedGlobs...)
+	clone.IncludeGenerated = append([]string(nil), r.IncludeGenerated...)
+	clone.AliasPolicy.Forbidden = append([]string(nil), r.AliasPolicy.Forbidden...)
+	clone.AliasPolicy.Pinned = maps.Clone(r.AliasPolicy.Pinned)
+	clone.ImportKinds.Groups = append([]string(nil), r.ImportKinds.Groups...)
+	clone.ImportRules = nil
+	for _, rule := range r.ImportRules {
+		rule.Selectors = maps.Clone(rule.Selectors)
+		clone.ImportRules = append(clone.ImportRules, rule)
+	}
+	clone.Architecture = nil
+	for _, rule := range r.Architecture {
+		rule.From = append([]string(nil), rule.From...)
+		rule.Deny = append([]string(nil), rule.Deny...)
+		rule.Allow = append([]string(nil), rule.Allow...)
+		clone.Architecture = append(clone.Architecture, rule)
+	}
+	clone.Sections = nil
+	for _, section := range r.Sections {
+		clone.Sections = append(clone.Sections, append([]string(nil), section...))
+	}
+	return &clone
+}
+
+// Diagnostic is a problem found in a file, reported in check mode.
+type Diagnostic struct {
+	File    string `json:"file"`           // File the problem was found in.
+	Line    int    `json:"line,omitempty"` // Line of the offending import, 0 for the whole file.
+	Rule    string `json:"rule"`           // Name of the violated rule (e.g. "internal-import").
+	Message string `json:"message"`
+}
+
+// String formats the diagnostic as "file:line: message [rule]".
+func (d Diagnostic) String() string {
+	pos := d.File
+	if d.Line > 0 {
+		pos += ":" + strconv.Itoa(d.Line)
+	}
+	return pos + ": " + d.Message + " [" + d.Rule + "]"
+}
+
+// FileResult is the outcome of organizing and checking the imports of a file's code.
+type FileResult struct {
+	File        string       `json:"file"`
+	Source      []byte       `json:"-"`       // Code with organized imports, the original code if skipped.
+	Changed     bool         `json:"changed"` // Whether Source differs from the original code.
+	Skipped     bool         `json:"skipped"` // Generated file left alone.
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Graph is an import dependency graph between packages, projects or groups.
+type Graph struct {
+	Nodes []string    `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphEdge is a dependency between two graph nodes.
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"` // Number of imports making up the dependency.
+}
+
+// Stats summarises the imports of a tree.
+type Stats struct {
+	Files           int            `json:"files"`            // Files with imports.
+	Imports         int            `json:"imports"`          // Imports of all files.
+	Modules         []Count        `json:"modules"`          // External modules by files importing them.
+	ProjectInternal []InternalStat `json:"project_internal"` // Files importing the internal packages of each project.
+	Aliases         []AliasStat    `json:"aliases"`          // Aliases of import paths imported with one.
+	LargestFiles    []Count        `json:"largest_files"`    // Files by number of imports.
+}
+
+// Count is a named count.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// InternalStat counts the files importing a project's internal packages.
+type InternalStat struct {
+	Project string `json:"project"`
+	Files   int    `json:"files"`   // All files importing them.
+	Outside int    `json:"outside"` // Files of other projects or outside any project importing them.
+}
+
+// AliasStat counts the names an import path is imported by, "" for no alias.
+type AliasStat struct {
+	Path         string  `json:"path"`
+	Aliases      []Count `json:"aliases"`
+	Inconsistent bool    `json:"inconsistent"` // Imported by more than one name.
 }
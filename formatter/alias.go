@@ -0,0 +1,206 @@
+package formatter
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"goimporter/entities"
+)
+
+// versionSuffix matches the version element of versioned import paths, e.g. "v2" or "yaml.v3".
+var versionSuffix = regexp.MustCompile(`(?:^|\.)v(?:[2-9]|[1-9][0-9]+)$`)
+
+// aliasFix is an alias policy violation of an import together with the alias fixing it.
+type aliasFix struct {
+	imp     entities.Import
+	alias   string // Alias fixing the violation, empty for none.
+	rule    string
+	message string
+}
+
+// aliasFixes finds the imports violating an alias policy. Blank, dot and cgo imports are exempt.
+// Names are the names import paths are imported by in most files, checked if the policy asks for
+// consistent aliases; pinned aliases take precedence over them and over the other conventions.
+func aliasFixes(
+	imports []entities.Import,
+	policy entities.AliasPolicy,
+	names map[string]string,
+	mod *entities.Module,
+) []aliasFix {
+	var fixes []aliasFix
+	for _, imp := range imports {
+		if imp.Alias == "_" || imp.Alias == "." || imp.Path == "C" {
+			continue
+		}
+
+		name := PackageName(imp.Path, mod)
+		current := ImportName(imp, mod)
+		suffix := policy.ProtobufSuffix
+		protobuf := suffix != "" && isProtobuf(imp.Path, mod)
+		versioned := policy.VersionedAlias && isVersioned(imp.Path)
+
+		// The alias the policy asks for, if any.
+		preferred := ""
+		switch {
+		case protobuf && !strings.HasSuffix(name, suffix):
+			preferred = name + suffix
+		case versioned:
+			preferred = name
+		}
+
+		pinned, isPinned := policy.Pinned[imp.Path]
+		common := ""
+		if policy.Consistent {
+			common = names[imp.Path]
+		}
+
+		rule := RuleAliasPolicy
+		var message string
+		switch {
+		case isPinned && current == pinned:
+			continue
+		case isPinned:
+			preferred = pinned
+			message = fmt.Sprintf("%q must be imported as %s", imp.Path, pinned)
+		case imp.Alias != "" && slices.Contains(policy.Forbidden, imp.Alias):
+			message = fmt.Sprintf("alias %s of %q is forbidden", imp.Alias, imp.Path)
+		case protobuf && !strings.HasSuffix(current, suffix):
+			message = fmt.Sprintf("protobuf package %q must be imported with the %q suffix", imp.Path, suffix)
+		case versioned && imp.Alias == "":
+			message = fmt.Sprintf("versioned package %q must be imported with an alias", imp.Path)
+		case policy.NoRedundant && imp.Alias == name && preferred == "":
+			message = fmt.Sprintf("alias %s of %q repeats the package name", imp.Alias, imp.Path)
+		case common != "" && current != common:
+			rule = RuleInconsistentAlias
+			message = fmt.Sprintf("%q is imported as %s, but as %s in most files", imp.Path, current, common)
+			if common != name || versioned {
+				preferred = common
+			}
+		default:
+			continue
+		}
+
+		fixes = append(fixes, aliasFix{imp: imp, alias: preferred, rule: rule, message: message})
+	}
+	return fixes
+}
+
+// aliasViolations finds the imports violating an alias policy, for check mode.
+func aliasViolations(
+	imports []entities.Import,
+	policy entities.AliasPolicy,
+	names map[string]string,
+	mod *entities.Module,
+) []finding {
+	var findings []finding
+	for _, fix := range aliasFixes(imports, policy, names, mod) {
+		findings = append(findings, finding{imp: fix.imp, rule: fix.rule, message: fix.message})
+	}
+	return findings
+}
+
+// FixAliases applies an alias policy to the imports of a file and renames the alias uses in its code.
+// Names are the names import paths are imported by in most files, for consistent aliases (nil if unknown).
+// Fixes that would clash with another import or a declaration of the file are skipped.
+func FixAliases(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	policy entities.AliasPolicy,
+	names map[string]string,
+	mod *entities.Module,
+) ([]byte, []entities.Import, error) {
+	code, imports, _, err := fixAliases(filename, code, imports, policy, names, mod)
+	return code, imports, err
+}
+
+// fixAliases is FixAliases, also returning the fixes refused because the old or new name of an
+// import is shadowed by a declaration of the file, which renaming could make refer to the wrong thing.
+func fixAliases(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	policy entities.AliasPolicy,
+	names map[string]string,
+	mod *entities.Module,
+) ([]byte, []entities.Import, []finding, error) {
+	fixes := aliasFixes(imports, policy, names, mod)
+	if len(fixes) == 0 {
+		return code, imports, nil, nil
+	}
+
+	_, file, err := parseResolved(filename, code)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	shadowed := shadowedNames(file)
+
+	// Names that a renamed import must not take.
+	taken := make(map[string]bool)
+	for _, imp := range imports {
+		taken[ImportName(imp, mod)] = true
+	}
+	for _, name := range declaredNames(file) {
+		taken[name] = true
+	}
+
+	fixed := append([]entities.Import(nil), imports...)
+	renames := make(map[string]string)
+	var refused []finding
+	for _, fix := range fixes {
+		imp := fix.imp
+		imp.Alias = fix.alias
+		if slices.Contains(policy.Forbidden, imp.Alias) {
+			continue
+		}
+
+		oldName, newName := ImportName(fix.imp, mod), ImportName(imp, mod)
+		if oldName != newName {
+			if shadow := shadowedName(shadowed, oldName, newName); shadow != "" {
+				refused = append(refused, finding{
+					imp:  fix.imp,
+					rule: RuleShadowedImport,
+					message: fmt.Sprintf("%q is not renamed from %s to %s: %s is shadowed by a declaration in the file",
+						fix.imp.Path, oldName, newName, shadow),
+				})
+				continue
+			}
+			if taken[newName] {
+				continue
+			}
+			taken[newName] = true
+			renames[oldName] = newName
+		}
+
+		for i := range fixed {
+			if fixed[i] == fix.imp {
+				fixed[i] = imp
+			}
+		}
+	}
+
+	code, err = RenameSelectors(filename, code, renames)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return code, fixed, refused, nil
+}
+
+// isVersioned checks if an import path ends in a major version, e.g. ".../v2" or "gopkg.in/yaml.v3".
+func isVersioned(importPath string) bool {
+	return versionSuffix.MatchString(path.Base(importPath))
+}
+
+// isProtobuf checks if the package at an import path contains generated protobuf code (*.pb.go files).
+func isProtobuf(importPath string, mod *entities.Module) bool {
+	dir := packageDir(importPath, mod)
+	if dir == "" {
+		return false
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.pb.go"))
+	return len(matches) > 0
+}
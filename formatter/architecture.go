@@ -0,0 +1,90 @@
+package formatter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"goimporter/entities"
+)
+
+// architectureViolations finds the imports of a file denied by the architecture rules applying to its package.
+// Imports and the file's own package are classified like GroupImports does for the file's project.
+// Files outside a module have no known location and are not checked.
+func architectureViolations(
+	filename string,
+	imports []entities.Import,
+	repo *entities.RepoConfig,
+	mod *entities.Module,
+	project *entities.Project,
+) []finding {
+	pkgPath := PackagePath(filename, mod)
+	if len(repo.Architecture) == 0 || pkgPath == "" {
+		return nil
+	}
+	location := pathGroup(pkgPath, repo, mod, project)
+
+	var findings []finding
+	for _, rule := range repo.Architecture {
+		if !matchAnySelector(rule.From, pkgPath, location, repo) {
+			continue
+		}
+
+		for _, imp := range imports {
+			if imp.Path == "C" {
+				continue
+			}
+			group := pathGroup(imp.Path, repo, mod, project)
+			if !matchAnySelector(rule.Deny, imp.Path, group, repo) || matchAnySelector(rule.Allow, imp.Path, group, repo) {
+				continue
+			}
+
+			message := fmt.Sprintf("%s package %q must not import %s package %q", location, pkgPath, group, imp.Path)
+			if rule.Name != "" {
+				message += " (" + rule.Name + ")"
+			}
+			if rule.Message != "" {
+				message += ": " + rule.Message
+			}
+			findings = append(findings, finding{imp: imp, rule: RuleArchitecture, message: message})
+		}
+	}
+	return findings
+}
+
+// matchAnySelector checks if a package, classified into a group, matches any architecture rule selector:
+// a group name, "project" for the packages of any project, or an import path pattern.
+func matchAnySelector(selectors []string, importPath, group string, repo *entities.RepoConfig) bool {
+	for _, selector := range selectors {
+		switch {
+		case strings.ContainsAny(selector, "./"):
+			if matchPathPattern(selector, importPath) {
+				return true
+			}
+		case selector == "project":
+			if MatchProject(importPath, repo) != nil {
+				return true
+			}
+		case selector == group:
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern matches an import path against a pattern where * matches one path element
+// and a trailing "/..." the path itself and any packages below.
+func matchPathPattern(pattern, importPath string) bool {
+	base, below := strings.CutSuffix(pattern, "/...")
+	patternElems, pathElems := strings.Split(base, "/"), strings.Split(importPath, "/")
+	if len(pathElems) < len(patternElems) || (!below && len(pathElems) != len(patternElems)) {
+		return false
+	}
+
+	for i, elem := range patternElems {
+		if ok, _ := path.Match(elem, pathElems[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package formatter
+
+import (
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+
+	"github.com/pkg/errors"
+)
+
+// NormalizeBuildConstraints adds a //go:build line matching the // +build lines of a file
+// that has none, like gofmt does. The // +build lines are kept for older Go versions.
+func NormalizeBuildConstraints(code []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing build constraints")
+	}
+
+	// Build constraints are only valid before the package clause.
+	var expr constraint.Expr
+	insert := -1
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if constraint.IsGoBuild(comment.Text) {
+				return code, nil
+			}
+			if !constraint.IsPlusBuild(comment.Text) {
+				continue
+			}
+
+			line, err := constraint.Parse(comment.Text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing %q", comment.Text)
+			}
+
+			// Multiple // +build lines must all be satisfied.
+			if expr == nil {
+				expr = line
+				insert = fset.Position(comment.Pos()).Offset
+			} else {
+				expr = &constraint.AndExpr{X: expr, Y: line}
+			}
+		}
+	}
+	if expr == nil {
+		return code, nil
+	}
+
+	out := make([]byte, 0, len(code)+len(expr.String())+12)
+	out = append(out, code[:insert]...)
+	out = append(out, "//go:build "+expr.String()+"\n"...)
+	return append(out, code[insert:]...), nil
+}
@@ -0,0 +1,223 @@
+package formatter
+
+import (
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"goimporter/entities"
+)
+
+// Rules reported in check mode.
+const (
+	// RuleUnsorted reports files whose imports are not grouped and sorted.
+	RuleUnsorted = "unsorted-imports"
+	// RuleInternalImport reports imports of another project's internal packages.
+	RuleInternalImport = "internal-import"
+	// RuleImportConflict reports imports binding the same name.
+	RuleImportConflict = "import-conflict"
+	// RuleAliasPolicy reports imports violating the alias policy.
+	RuleAliasPolicy = "alias-policy"
+	// RuleInconsistentAlias reports imports by another name than most files use.
+	RuleInconsistentAlias = "inconsistent-alias"
+	// RuleBlankComment reports blank imports without a justification comment.
+	RuleBlankComment = "blank-import-comment"
+	// RuleDotImport reports dot imports outside test files.
+	RuleDotImport = "dot-import"
+	// RuleBannedImport reports imports banned by an import rule.
+	RuleBannedImport = "banned-import"
+	// RuleDeprecatedImport reports imports deprecated by an import rule.
+	RuleDeprecatedImport = "deprecated-import"
+	// RuleArchitecture reports imports denied by an architecture rule.
+	RuleArchitecture = "architecture"
+	// RuleShadowedImport reports fixes not applied because an import's name is shadowed.
+	RuleShadowedImport = "shadowed-import"
+)
+
+// finding is a problem with a single import, before its line is known.
+type finding struct {
+	imp     entities.Import
+	nth     int // Occurrence of the import among identical ones, 0 for the first.
+	rule    string
+	message string
+}
+
+// CheckImports reports import violations of a file belonging to a project (nil if none):
+//   - imports of other projects' internal packages, which break architecture boundaries even
+//     where the compiler's internal rule doesn't catch them;
+//   - imports binding the same name, which don't compile;
+//   - aliases violating the alias policy, including pinned aliases;
+//   - blank imports without a justification comment and dot imports outside test files,
+//     if the import kind rules ask for it;
+//   - banned and deprecated imports;
+//   - imports denied by the architecture rules applying to the file's package.
+func CheckImports(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	repo *entities.RepoConfig,
+	mod *entities.Module,
+	project *entities.Project,
+) ([]entities.Diagnostic, error) {
+	return checkImports(filename, code, imports, repo, mod, project, nil)
+}
+
+// checkImports is CheckImports with the names import paths are imported by in most files,
+// for consistent aliases.
+func checkImports(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	repo *entities.RepoConfig,
+	mod *entities.Module,
+	project *entities.Project,
+	names map[string]string,
+) ([]entities.Diagnostic, error) {
+	var findings []finding
+	findings = append(findings, internalImports(imports, repo, project)...)
+	findings = append(findings, conflictingImports(imports, mod)...)
+	findings = append(findings, aliasViolations(imports, repo.AliasPolicy, names, mod)...)
+	findings = append(findings, kindViolations(filename, imports, repo.ImportKinds)...)
+	findings = append(findings, importRuleViolations(imports, repo.ImportRules)...)
+	findings = append(findings, architectureViolations(filename, imports, repo, mod, project)...)
+	return findingDiagnostics(filename, code, findings)
+}
+
+// findingDiagnostics locates the imports of findings in a file's code to report them.
+func findingDiagnostics(filename string, code []byte, findings []finding) ([]entities.Diagnostic, error) {
+	if len(findings) == 0 {
+		return nil, nil
+	}
+
+	lines, err := importLines(filename, code)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := make([]entities.Diagnostic, 0, len(findings))
+	for _, f := range findings {
+		line := 0
+		if l := lines[importKey(f.imp)]; len(l) > 0 {
+			line = l[min(f.nth, len(l)-1)]
+		}
+		diagnostics = append(diagnostics, entities.Diagnostic{
+			File:    filename,
+			Line:    line,
+			Rule:    f.rule,
+			Message: f.message,
+		})
+	}
+	return diagnostics, nil
+}
+
+// internalImports finds imports of other projects' internal packages.
+func internalImports(imports []entities.Import, repo *entities.RepoConfig, project *entities.Project) []finding {
+	var findings []finding
+	for _, imp := range imports {
+		other := MatchProject(imp.Path, repo)
+		if other == nil || (project != nil && other.Root == project.Root) {
+			continue
+		}
+		if !strings.HasPrefix(imp.Path, other.Root+"/internal/") && imp.Path != other.Root+"/internal" {
+			continue
+		}
+
+		findings = append(findings, finding{
+			imp:     imp,
+			rule:    RuleInternalImport,
+			message: "import of internal package " + strconv.Quote(imp.Path) + " of project " + other.Name,
+		})
+	}
+	return findings
+}
+
+// conflictingImports finds imports binding a name already taken by another import, whether of
+// another package or of the same one. The same package imported under several names is legitimate
+// and not reported.
+func conflictingImports(imports []entities.Import, mod *entities.Module) []finding {
+	var findings []finding
+	paths := make(map[string]string)
+	seen := make(map[string]int)
+	for _, imp := range imports {
+		nth := seen[importKey(imp)]
+		seen[importKey(imp)]++
+		if imp.Alias == "_" || imp.Alias == "." {
+			continue
+		}
+
+		name := ImportName(imp, mod)
+		first, ok := paths[name]
+		switch {
+		case !ok:
+			paths[name] = imp.Path
+		case first != imp.Path:
+			findings = append(findings, finding{
+				imp:  imp,
+				rule: RuleImportConflict,
+				message: strconv.Quote(imp.Path) + " is imported as " + name + ", which is already the name of " +
+					strconv.Quote(first) + "; add an alias to one of them",
+			})
+		default:
+			findings = append(findings, finding{
+				imp:     imp,
+				rule:    RuleImportConflict,
+				nth:     nth,
+				message: strconv.Quote(imp.Path) + " is imported twice as " + name + "; remove one of them",
+			})
+		}
+	}
+	return findings
+}
+
+// kindViolations finds blank imports without a justification comment and dot imports outside test files.
+func kindViolations(filename string, imports []entities.Import, rules entities.KindRules) []finding {
+	var findings []finding
+	for _, imp := range imports {
+		switch {
+		case rules.RequireBlankComment && imp.Kind() == entities.KindBlank && imp.Doc == "" && imp.Comment == "":
+			findings = append(findings, finding{
+				imp:     imp,
+				rule:    RuleBlankComment,
+				message: "blank import of " + strconv.Quote(imp.Path) + " needs a comment justifying it",
+			})
+		case rules.NoDotImports && imp.Kind() == entities.KindDot && !strings.HasSuffix(filename, "_test.go"):
+			findings = append(findings, finding{
+				imp:     imp,
+				rule:    RuleDotImport,
+				message: "dot import of " + strconv.Quote(imp.Path) + " outside a test file",
+			})
+		}
+	}
+	return findings
+}
+
+// importKey identifies an import by its alias and path.
+func importKey(imp entities.Import) string {
+	return imp.Alias + " " + imp.Path
+}
+
+// importLines returns the lines of the imports of a file, by import key, in order.
+func importLines(filename string, code []byte) (map[string][]int, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, code, parser.ImportsOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing imports")
+	}
+
+	lines := make(map[string][]int, len(file.Imports))
+	for _, spec := range file.Imports {
+		imp := entities.Import{}
+		imp.Path, err = strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			imp.Alias = spec.Name.Name
+		}
+		lines[importKey(imp)] = append(lines[importKey(imp)], fset.Position(spec.Path.Pos()).Line)
+	}
+	return lines, nil
+}
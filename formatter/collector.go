@@ -1,8 +1,11 @@
 package formatter
 
 import (
-	"bufio"
 	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -10,68 +13,265 @@ import (
 	"goimporter/entities"
 )
 
-// CollectImports extracts all import statements from Go source code.
+// CollectImports extracts the imports of every import declaration of Go source code, with their
+// comments. Comments in a declaration attached to no import, such as commented-out imports, are kept
+// with the import following them. In the first declaration, those on the line of "import (" or after
+// the last import stay in place when the declaration is rewritten; in the others, which are merged
+// into it, they are kept with the last import, like the declarations' doc comments with the first.
+// Single cgo imports of "C" are left out, since their doc comment is the cgo preamble.
 func CollectImports(code []byte) ([]entities.Import, error) {
-	var allImports []entities.Import
-
-	scanner := bufio.NewScanner(bytes.NewReader(code))
-	inImportBlock := false
-	foundFirstBlock := false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		// Detect import block boundaries.
-		if trimmedLine == "import (" {
-			if !foundFirstBlock {
-				foundFirstBlock = true
-				inImportBlock = true
-				continue
-			}
+	fset, file, err := parseImports(code)
+	if err != nil {
+		return nil, err
+	}
+
+	var imports []entities.Import
+	for i, gen := range importDecls(file) {
+		var kept map[*ast.CommentGroup]bool
+		var doc []string
+		if i == 0 {
+			kept = keptComments(fset, file, gen)
+		} else if gen.Doc != nil {
+			doc = commentLines(fset, code, gen.Doc)
 		}
 
-		if inImportBlock && trimmedLine == ")" {
-			inImportBlock = false
-			continue
+		attached := make(map[*ast.CommentGroup]bool)
+		for _, s := range gen.Specs {
+			spec := s.(*ast.ImportSpec)
+			attached[spec.Doc] = true
+			attached[spec.Comment] = true
 		}
 
-		// Process import lines.
-		if inImportBlock && trimmedLine != "" && !strings.HasPrefix(trimmedLine, "//") {
-			// Extract import path and alias.
-			importPath, alias := parseImportLine(trimmedLine)
+		groups := declComments(file, gen)
+		for _, s := range gen.Specs {
+			spec := s.(*ast.ImportSpec)
+			for len(groups) > 0 && groups[0].Pos() < spec.Pos() {
+				if !attached[groups[0]] && !kept[groups[0]] {
+					doc = append(doc, commentLines(fset, code, groups[0])...)
+				}
+				groups = groups[1:]
+			}
+			if spec.Doc != nil {
+				doc = append(doc, commentLines(fset, code, spec.Doc)...)
+			}
 
-			if importPath != "" {
-				allImports = append(allImports, entities.Import{Alias: alias, Path: importPath})
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid import path %s", spec.Path.Value)
+			}
+			imp := entities.Import{Path: importPath, Doc: strings.Join(doc, "\n")}
+			if spec.Name != nil {
+				imp.Alias = spec.Name.Name
+			}
+			if spec.Comment != nil {
+				imp.Comment = strings.Join(commentLines(fset, code, spec.Comment), " ")
 			}
+			imports = append(imports, imp)
+			doc = nil
+		}
+
+		// Comments after the last import of a merged declaration move with it.
+		for _, group := range groups {
+			if !attached[group] && !kept[group] {
+				doc = append(doc, commentLines(fset, code, group)...)
+			}
+		}
+		if len(doc) > 0 && len(imports) > 0 {
+			last := &imports[len(imports)-1]
+			if last.Doc != "" {
+				doc = append([]string{last.Doc}, doc...)
+			}
+			last.Doc = strings.Join(doc, "\n")
+		}
+	}
+	return imports, nil
+}
+
+// AllImports returns the imports of every import declaration of Go source code, with their aliases
+// but without comments. Unlike CollectImports, it also sees single imports and further blocks.
+func AllImports(code []byte) ([]entities.Import, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ImportsOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing imports")
+	}
+
+	imports := make([]entities.Import, 0, len(file.Imports))
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid import path %s", spec.Path.Value)
+		}
+		imp := entities.Import{Path: importPath}
+		if spec.Name != nil {
+			imp.Alias = spec.Name.Name
+		}
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+// importBlock holds the offsets of the import declarations in Go source code.
+type importBlock struct {
+	start  int      // Offset of the import keyword of the first declaration.
+	lparen int      // Offset of its opening parenthesis, -1 for a single import.
+	rparen int      // Offset of its closing parenthesis, or the end of a single import.
+	kept   int      // Offset of the first comment kept after the last import, -1 if none.
+	inline bool     // Whether the first import is on the line of the opening parenthesis.
+	others [][2]int // Offsets of the lines of the other declarations, merged into the first.
+}
+
+// findImportBlock locates the import declarations of Go source code, or returns nil if there
+// are none. Comments, build constraints and directives outside the declarations are never
+// part of them, apart from the doc comments of the declarations after the first.
+func findImportBlock(code []byte) (*importBlock, error) {
+	fset, file, err := parseImports(code)
+	if err != nil {
+		return nil, err
+	}
+	decls := importDecls(file)
+	if len(decls) == 0 {
+		return nil, nil
+	}
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+
+	gen := decls[0]
+	block := &importBlock{start: offset(gen.TokPos), lparen: -1, kept: -1}
+	for _, other := range decls[1:] {
+		start := other.Pos()
+		if other.Doc != nil {
+			start = other.Doc.Pos()
+		}
+		end := other.End()
+		if !other.Lparen.IsValid() {
+			end = lastImportEnd(other)
 		}
+		block.others = append(block.others, [2]int{lineStart(code, offset(start)), lineEnd(code, offset(end))})
 	}
 
-	err := scanner.Err()
+	if !gen.Lparen.IsValid() {
+		block.rparen = offset(lastImportEnd(gen))
+		return block, nil
+	}
+	block.lparen, block.rparen = offset(gen.Lparen), offset(gen.Rparen)
+	if len(gen.Specs) == 0 {
+		return block, nil
+	}
+	block.inline = fset.Position(gen.Specs[0].Pos()).Line == fset.Position(gen.Lparen).Line
+
+	last := lastImportEnd(gen)
+	for _, group := range declComments(file, gen) {
+		if group.Pos() >= last {
+			block.kept = offset(group.Pos())
+			break
+		}
+	}
+	return block, nil
+}
+
+// lineStart returns the offset of the start of the line holding an offset.
+func lineStart(code []byte, offset int) int {
+	return bytes.LastIndexByte(code[:offset], '\n') + 1
+}
+
+// lineEnd returns the offset following the end of the line holding an offset, including its newline.
+func lineEnd(code []byte, offset int) int {
+	if i := bytes.IndexByte(code[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(code)
+}
+
+// parseImports parses the package clause and import declarations of Go source code, with comments.
+func parseImports(code []byte) (*token.FileSet, *ast.File, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, parser.ImportsOnly|parser.ParseComments)
 	if err != nil {
-		return nil, errors.Wrap(err, "scanning imports")
+		return nil, nil, errors.Wrap(err, "parsing imports")
 	}
+	return fset, file, nil
+}
 
-	return allImports, nil
+// importDecls returns the import declarations of a file, except single imports of "C".
+func importDecls(file *ast.File) []*ast.GenDecl {
+	var decls []*ast.GenDecl
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if !gen.Lparen.IsValid() && gen.Specs[0].(*ast.ImportSpec).Path.Value == `"C"` {
+			continue
+		}
+		decls = append(decls, gen)
+	}
+	return decls
+}
+
+// declComments returns the comments inside the parentheses of an import declaration.
+func declComments(file *ast.File, gen *ast.GenDecl) []*ast.CommentGroup {
+	if !gen.Lparen.IsValid() {
+		return nil
+	}
+
+	var groups []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if group.Pos() > gen.Lparen && group.End() < gen.Rparen {
+			groups = append(groups, group)
+		}
+	}
+	return groups
 }
 
-// parseImportLine extracts import path and optional alias from a line.
-func parseImportLine(line string) (path, alias string) {
-	// Extract the path from the quotes.
-	startQuote := strings.Index(line, "\"")
-	endQuote := strings.LastIndex(line, "\"")
+// keptComments returns the comments of an import declaration that stay in place when its imports are
+// rewritten: those on the line of the opening parenthesis, unless an import is too, and those after
+// the last import.
+func keptComments(fset *token.FileSet, file *ast.File, gen *ast.GenDecl) map[*ast.CommentGroup]bool {
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
 
-	if startQuote != -1 && endQuote != -1 && endQuote > startQuote {
-		path = line[startQuote+1 : endQuote]
+	var first, last token.Pos
+	if len(gen.Specs) > 0 {
+		first, last = gen.Specs[0].Pos(), lastImportEnd(gen)
+	}
 
-		// Check for alias before the quoted path.
-		beforeQuote := strings.TrimSpace(line[:startQuote])
-		if beforeQuote != "" {
-			alias = beforeQuote
+	kept := make(map[*ast.CommentGroup]bool)
+	for _, group := range declComments(file, gen) {
+		switch {
+		case line(group.Pos()) == line(gen.Lparen) && (!first.IsValid() || line(first) != line(gen.Lparen)):
+			kept[group] = true
+		case group.Pos() >= last:
+			kept[group] = true
 		}
+	}
+	return kept
+}
 
-		return path, alias
+// lastImportEnd returns the end of the last import of a non-empty import declaration,
+// including its trailing comment.
+func lastImportEnd(gen *ast.GenDecl) token.Pos {
+	spec := gen.Specs[len(gen.Specs)-1].(*ast.ImportSpec)
+	if spec.Comment != nil {
+		return spec.Comment.End()
 	}
+	return spec.End()
+}
+
+// commentLines returns the lines of a comment group. The indentation of the lines continuing
+// a /*-style comment is removed up to the comment's own, so that it can be indented anew.
+func commentLines(fset *token.FileSet, code []byte, group *ast.CommentGroup) []string {
+	var lines []string
+	for _, c := range group.List {
+		offset := fset.Position(c.Pos()).Offset
+		indent := string(code[bytes.LastIndexByte(code[:offset], '\n')+1 : offset])
+		if strings.TrimLeft(indent, " \t") != "" {
+			indent = ""
+		}
 
-	return "", ""
+		for i, line := range strings.Split(c.Text, "\n") {
+			if i > 0 {
+				line = strings.TrimPrefix(line, indent)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
 }
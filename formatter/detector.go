@@ -1,90 +1,114 @@
 package formatter
 
 import (
-	"bufio"
-	"bytes"
-	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 
 	"goimporter/entities"
 )
 
-// IsGeneratedFile checks if a file is generated based on its first few lines.
+// IsGeneratedFile checks if a file is generated following the Go convention: a
+// "// Code generated ... DO NOT EDIT." comment anywhere before the package clause, as ast.IsGenerated.
 func IsGeneratedFile(code []byte) bool {
-	scanner := bufio.NewScanner(bytes.NewReader(code))
+	file := parseHeader(code)
+	return file != nil && ast.IsGenerated(file)
+}
 
-	// Check first few lines (more reliable than just the first line).
-	lineCount := 0
-	foundPackage := false
+// IsGenerated checks if a file is generated, by the Go convention or by the repository's
+// generated-file markers and path globs.
+func IsGenerated(filename string, code []byte, repo *entities.RepoConfig) bool {
+	if matchGlobs(filename, repo.GeneratedGlobs) {
+		return true
+	}
 
-	for scanner.Scan() && lineCount < 10 {
-		line := scanner.Text()
-		lineCount++
+	file := parseHeader(code)
+	if file == nil {
+		return false
+	}
+	if ast.IsGenerated(file) {
+		return true
+	}
+	if len(repo.GeneratedMarkers) == 0 {
+		return false
+	}
 
-		// Skip empty lines.
-		if strings.TrimSpace(line) == "" {
-			continue
+	// Heuristic markers in comments before the package clause.
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
 		}
-
-		// Check if this is the package declaration.
-		if strings.HasPrefix(strings.TrimSpace(line), "package ") {
-			foundPackage = true
-			continue
+		text := strings.ToLower(group.Text())
+		for _, marker := range repo.GeneratedMarkers {
+			if marker != "" && strings.Contains(text, strings.ToLower(marker)) {
+				return true
+			}
 		}
+	}
+	return false
+}
 
-		// Generated markers should be before package declaration.
-		if foundPackage {
-			continue
-		}
+// generatedBy matches the generator of a "// Code generated by <generator> ... DO NOT EDIT." comment.
+var generatedBy = regexp.MustCompile(`^// Code generated by (\S+).* DO NOT EDIT\.$`)
 
-		// Check for common generated file markers.
-		lowercaseLine := strings.ToLower(line)
-		if strings.Contains(lowercaseLine, "generated") &&
-			(strings.Contains(line, "//") || strings.Contains(line, "/*")) {
-			return true
-		}
+// GeneratorName returns the generator named in a file's "// Code generated by ... DO NOT EDIT."
+// comment, e.g. "sqlc", or an empty string if there is none.
+func GeneratorName(code []byte) string {
+	file := parseHeader(code)
+	if file == nil {
+		return ""
+	}
 
-		// Common explicit markers.
-		for _, marker := range []string{
-			"do not edit",
-			"auto-generated",
-			"autogenerated",
-			"code generated",
-			"by mockgen",
-			"by protoc",
-			"automatically generated",
-		} {
-			if strings.Contains(lowercaseLine, marker) {
-				return true
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if m := generatedBy.FindStringSubmatch(comment.Text); m != nil {
+				return strings.TrimRight(m[1], ".,;:")
 			}
 		}
 	}
+	return ""
+}
 
+// parseHeader parses the comments and package clause of a file, or returns nil if it has none.
+func parseHeader(code []byte) *ast.File {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	return file
+}
+
+// matchGlobs checks if a file path matches any of the globs. Globs without a slash match
+// the file name, others match the same number of trailing path elements (e.g. "api/*.pb.go").
+func matchGlobs(filename string, globs []string) bool {
+	filename = filepath.ToSlash(filename)
+	elems := strings.Split(filename, "/")
+	for _, glob := range globs {
+		n := strings.Count(glob, "/") + 1
+		if n > len(elems) {
+			continue
+		}
+		if ok, _ := path.Match(glob, strings.Join(elems[len(elems)-n:], "/")); ok {
+			return true
+		}
+	}
 	return false
 }
 
 // ExtractProjectName extracts the project name from a file path.
 func ExtractProjectName(filePath string, repo *entities.RepoConfig) string {
-	// Extract domain part from projects template.
-	domainPart := extractDomainFromTemplate(repo.ProjectsTemplate)
-	if domainPart == "" {
+	project := extractProject(filePath, repo)
+	if project == nil {
 		return ""
 	}
-
-	// Create a regex pattern to match project name from the path.
-	pattern := strings.ReplaceAll(regexp.QuoteMeta(repo.RepoPrefix), "/", "\\/") +
-		"\\/projects\\/" + domainPart + "\\/([^\\/]+)"
-	re := regexp.MustCompile(pattern)
-	matches := re.FindStringSubmatch(filePath)
-
-	if len(matches) > 1 {
-		if matches[1] == "pkg" {
-			return ""
-		}
-		return matches[1]
-	}
-	return ""
+	return project.Name
 }
 
 // extractDomainFromTemplate extracts the domain name from a projects template.
@@ -100,17 +124,17 @@ func extractDomainFromTemplate(template string) string {
 
 // GetImportPrefixes returns the ordered list of import prefixes to use for grouping.
 func GetImportPrefixes(filePath string, repo *entities.RepoConfig) []string {
-	projectName := ExtractProjectName(filePath, repo)
+	project := extractProject(filePath, repo)
 	prefixes := []string{
 		repo.RepoPrefix,
 		repo.CommonPrefix,
 		repo.DomainPrefix,
 	}
 
-	if projectName != "" {
+	if project != nil {
 		// Project-specific prefixes (these are used for grouping only).
-		projectPkgPrefix := fmt.Sprintf(repo.ProjectsTemplate, projectName) + "/pkg"
-		projectInternalPrefix := fmt.Sprintf(repo.ProjectsTemplate, projectName) + "/internal"
+		projectPkgPrefix := project.Root + "/pkg"
+		projectInternalPrefix := project.Root + "/internal"
 
 		prefixes = append(prefixes, projectPkgPrefix, projectInternalPrefix)
 	}
@@ -1,9 +1,11 @@
 package formatter
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
+	"go/parser"
+	"go/token"
+	"slices"
 	"sort"
 	"strings"
 
@@ -13,247 +15,337 @@ import (
 )
 
 // GroupImports organizes imports into logical groups and removes duplicates.
+// The project is the one the file belongs to, nil if it is outside any project;
+// imports of other projects in the same domain are grouped as sibling projects.
+// Imports of the kinds configured in repo.ImportKinds.Groups are grouped by kind instead.
+// The module is optional and used to honour go.mod replace directives.
 // TODO: Add support for additional import groups with prefixes.
-func GroupImports(imports []entities.Import, _ []string, repo *entities.RepoConfig) entities.ImportGroups {
+func GroupImports(
+	imports []entities.Import,
+	_ []string,
+	repo *entities.RepoConfig,
+	mod *entities.Module,
+	project *entities.Project,
+) entities.ImportGroups {
 	groups := entities.ImportGroups{}
 
-	// Track processed paths to avoid duplicates.
+	// Track processed imports to merge true duplicates: imports of the same path binding the
+	// same name, such as "github.com/x/y" and y "github.com/x/y", which don't compile together.
+	// The same path imported under different names is kept, since the file may use every one of them.
 	processed := make(map[string]struct{})
 
-	// Extract domain part from projects template for path matching.
-	domainPart := extractDomainFromTemplate(repo.ProjectsTemplate)
-
-	// Collect all project paths for better detection.
-	projectImports := make(map[string]bool)
 	for _, imp := range imports {
-		if domainPart != "" && strings.Contains(imp.Path, "/projects/"+domainPart+"/") {
-			projectImports[imp.Path] = true
+		// Skip duplicates.
+		key := bindingKey(imp, mod)
+		if _, exists := processed[key]; exists {
+			continue
 		}
-	}
+		processed[key] = struct{}{}
 
-	// Current project detection based on the first project-specific import.
-	projectPrefix := ""
-	projectName := ""
-	for _, imp := range imports {
-		if domainPart != "" && strings.Contains(imp.Path, "/projects/"+domainPart+"/") &&
-			(strings.Contains(imp.Path, "/internal/") || strings.Contains(imp.Path, "/pkg/")) {
-			parts := strings.Split(imp.Path, "/")
-			for i, part := range parts {
-				if part == domainPart && i+1 < len(parts) {
-					projectName = parts[i+1]
-					if projectName != "pkg" {
-						projectPrefix = strings.Join(parts[:i+2], "/")
-						break
-					}
-				}
-			}
-			if projectPrefix != "" {
-				break
-			}
+		// Imports of the kinds grouped by kind are placed in their kind's group, whatever their path.
+		group := imp.Kind()
+		if !slices.Contains(repo.ImportKinds.Groups, group) {
+			group = pathGroup(imp.Path, repo, mod, project)
 		}
+		groups.Add(group, imp)
+	}
+
+	// Sort all groups.
+	for _, name := range entities.GroupNames {
+		sortImports(groups.Group(name))
 	}
 
-	// Project pkg and internal prefixes if a project was detected.
-	projectPkgPrefix := ""
-	projectInternalPrefix := ""
-	if projectPrefix != "" {
-		projectPkgPrefix = projectPrefix + "/pkg"
-		projectInternalPrefix = projectPrefix + "/internal"
+	return groups
+}
+
+// bindingKey identifies an import by the name it binds and its path.
+// Blank and dot imports bind no name of their own and are identified by their alias instead.
+func bindingKey(imp entities.Import, mod *entities.Module) string {
+	if imp.Alias == "_" || imp.Alias == "." {
+		return importKey(imp)
 	}
+	return ImportName(imp, mod) + " " + imp.Path
+}
 
+// pathGroup classifies an import path into a group, for a file of a project (nil if none).
+func pathGroup(importPath string, repo *entities.RepoConfig, mod *entities.Module, project *entities.Project) string {
 	// Better detection for project packages with specific patterns.
 	isProjectPkg := func(path string) bool {
-		return projectPkgPrefix != "" &&
-			strings.HasPrefix(path, projectPrefix) &&
+		return project != nil &&
+			strings.HasPrefix(path, project.Root+"/") &&
 			strings.Contains(path, "/pkg/")
 	}
 
 	isProjectInternal := func(path string) bool {
-		return projectInternalPrefix != "" &&
-			strings.HasPrefix(path, projectPrefix) &&
+		return project != nil &&
+			strings.HasPrefix(path, project.Root+"/") &&
 			strings.Contains(path, "/internal/")
 	}
 
-	for _, imp := range imports {
-		// Skip duplicates.
-		if _, exists := processed[imp.Path]; exists {
-			continue
-		}
-		processed[imp.Path] = struct{}{}
-
-		// Strict import classification.
-		switch {
-		case !strings.Contains(imp.Path, "."):
-			// Standard library (no dots in path).
-			groups.Stdlib = append(groups.Stdlib, imp)
-
-		case !strings.HasPrefix(imp.Path, repo.OrgPrefix):
-			// External packages (not from our organization).
-			groups.External = append(groups.External, imp)
-
-		case strings.HasPrefix(imp.Path, repo.CommonPrefix) ||
-			stringHasPrefixAny(imp.Path, repo.AdditionalCommonPrefixes) ||
-			(strings.HasPrefix(imp.Path, repo.OrgPrefix) &&
-				!strings.HasPrefix(imp.Path, repo.RepoPrefix)):
-			// Common organization packages:
-			// 1. Common packages (e.g. repo/pkg/*),
-			// 2. Additional common prefixes from config,
-			// 3. Any other organization packages (except known repo paths).
-			groups.OrgCommon = append(groups.OrgCommon, imp)
-
-		case strings.HasPrefix(imp.Path, repo.DomainPrefix):
-			// Domain packages.
-			groups.DomainCommon = append(groups.DomainCommon, imp)
-
-		case isProjectPkg(imp.Path):
-			// Project-specific pkg packages.
-			groups.ProjectPkg = append(groups.ProjectPkg, imp)
-
-		case isProjectInternal(imp.Path):
-			// Project-specific internal packages.
-			groups.ProjectInternal = append(groups.ProjectInternal, imp)
-
-		default:
-			// Other repository packages.
-			groups.RepoOther = append(groups.RepoOther, imp)
-		}
+	isSiblingProject := func(path string) bool {
+		other := MatchProject(path, repo)
+		return other != nil && project != nil && other.Root != project.Root && other.Domain == project.Domain
 	}
 
-	// Sort all groups.
-	sortImports(groups.Stdlib)
-	sortImports(groups.External)
-	sortImports(groups.OrgCommon)
-	sortImports(groups.DomainCommon)
-	sortImports(groups.RepoOther)
-	sortImports(groups.ProjectPkg)
-	sortImports(groups.ProjectInternal)
-
-	return groups
+	// Strict import classification.
+	switch {
+	case !strings.Contains(importPath, "."):
+		// Standard library (no dots in path).
+		return entities.GroupStdlib
+
+	case repo.ReplaceGrouping == entities.ReplaceGroupingLocal && isReplaced(importPath, mod):
+		// Replaced modules treated as part of the repository.
+		return entities.GroupRepoOther
+
+	case repo.ReplaceGrouping == entities.ReplaceGroupingOrg && isReplaced(importPath, mod):
+		// Replaced modules treated as organization forks.
+		return entities.GroupOrgCommon
+
+	case !strings.HasPrefix(importPath, repo.OrgPrefix):
+		// External packages (not from our organization).
+		return entities.GroupExternal
+
+	case (repo.CommonPrefix != "" && strings.HasPrefix(importPath, repo.CommonPrefix)) ||
+		stringHasPrefixAny(importPath, repo.AdditionalCommonPrefixes) ||
+		(strings.HasPrefix(importPath, repo.OrgPrefix) &&
+			!strings.HasPrefix(importPath, repo.RepoPrefix)):
+		// Common organization packages:
+		// 1. Common packages (e.g. repo/pkg/*),
+		// 2. Additional common prefixes from config,
+		// 3. Any other organization packages (except known repo paths).
+		return entities.GroupOrgCommon
+
+	case (repo.DomainPrefix != "" && strings.HasPrefix(importPath, repo.DomainPrefix)) ||
+		isDomainPkg(importPath, repo):
+		// Domain packages, including the pkg directories of layouts with a {domain} placeholder.
+		return entities.GroupDomainCommon
+
+	case isProjectPkg(importPath):
+		// Project-specific pkg packages.
+		return entities.GroupProjectPkg
+
+	case isProjectInternal(importPath):
+		// Project-specific internal packages.
+		return entities.GroupProjectInternal
+
+	case isSiblingProject(importPath):
+		// Packages of other projects.
+		return entities.GroupSiblingProject
+
+	default:
+		// Other repository packages.
+		return entities.GroupRepoOther
+	}
 }
 
-// sortImports sorts imports alphabetically by path.
+// sortImports sorts imports alphabetically by path, then by alias.
 func sortImports(imports []entities.Import) {
-	sort.Slice(imports, func(i, j int) bool {
-		return imports[i].Path < imports[j].Path
+	sort.SliceStable(imports, func(i, j int) bool {
+		if imports[i].Path != imports[j].Path {
+			return imports[i].Path < imports[j].Path
+		}
+		return imports[i].Alias < imports[j].Alias
 	})
 }
 
-// stringHasPrefixAny checks if a string has any of the given prefixes.
+// stringHasPrefixAny checks if a string has any of the given non-empty prefixes.
 func stringHasPrefixAny(s string, prefixes []string) bool {
 	for _, prefix := range prefixes {
-		if strings.HasPrefix(s, prefix) {
+		if prefix != "" && strings.HasPrefix(s, prefix) {
 			return true
 		}
 	}
 	return false
 }
 
-// RewriteFile generates a new file with organized imports.
-func RewriteFile(code []byte, groups entities.ImportGroups) ([]byte, error) {
-	var buf bytes.Buffer
-	scanner := bufio.NewScanner(bytes.NewReader(code))
-
-	foundFirstImport := false
-	inImportBlock := false
-	skipImportLines := false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		if trimmedLine == "import (" {
-			// Only process the first import block we find.
-			if !foundFirstImport {
-				foundFirstImport = true
-				inImportBlock = true
-
-				// Write the import statement with grouped imports.
-				indent := strings.TrimSuffix(line, "import (")
-				buf.WriteString(line + "\n")
-
-				// Helper function to write a group of imports with proper formatting.
-				writeImportGroup := func(imports []entities.Import, needNewline bool) {
-					if len(imports) == 0 {
-						return
-					}
+// SectionImports lays out import groups in sections according to the configured order.
+// Groups listed together are merged and sorted, unlisted groups are added to the last section.
+// Empty sections are omitted.
+func SectionImports(groups entities.ImportGroups, layout [][]string) [][]entities.Import {
+	if len(layout) == 0 {
+		for _, name := range entities.GroupNames {
+			layout = append(layout, []string{name})
+		}
+	}
 
-					if needNewline {
-						buf.WriteString("\n")
-					}
+	listed := make(map[string]bool)
+	for _, section := range layout {
+		for _, name := range section {
+			listed[name] = true
+		}
+	}
 
-					for _, imp := range imports {
-						if imp.Alias != "" {
-							buf.WriteString(fmt.Sprintf("%s\t%s %q\n", indent, imp.Alias, imp.Path))
-						} else {
-							buf.WriteString(fmt.Sprintf("%s\t%q\n", indent, imp.Path))
-						}
-					}
+	sections := make([][]entities.Import, 0, len(layout))
+	for i, section := range layout {
+		names := section
+		if i == len(layout)-1 {
+			for _, name := range entities.GroupNames {
+				if !listed[name] {
+					names = append(names[:len(names):len(names)], name)
 				}
+			}
+		}
 
-				// Write all groups with proper separation.
-				hasContent := false
-
-				// 1. Standard library.
-				writeImportGroup(groups.Stdlib, false)
-				hasContent = len(groups.Stdlib) > 0
+		var imports []entities.Import
+		for _, name := range names {
+			imports = append(imports, groups.Group(name)...)
+		}
+		if len(imports) == 0 {
+			continue
+		}
 
-				// 2. External packages.
-				writeImportGroup(groups.External, hasContent)
-				hasContent = hasContent || len(groups.External) > 0
+		if len(names) > 1 {
+			sortImports(imports)
+		}
+		sections = append(sections, imports)
+	}
 
-				// 3. Common organization packages.
-				writeImportGroup(groups.OrgCommon, hasContent)
-				hasContent = hasContent || len(groups.OrgCommon) > 0
+	return sections
+}
 
-				// 4. Domain packages.
-				writeImportGroup(groups.DomainCommon, hasContent)
-				hasContent = hasContent || len(groups.DomainCommon) > 0
+// RewriteFile generates a new file with organized imports. Only the contents of the first import
+// declaration are replaced, and the other import declarations merged into it; everything else,
+// including license headers, build constraints and directives, is kept byte for byte.
+func RewriteFile(code []byte, sections [][]entities.Import) ([]byte, error) {
+	block, err := findImportBlock(code)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return insertImportBlock(code, sections)
+	}
 
-				// 5. Other repository packages.
-				writeImportGroup(groups.RepoOther, hasContent)
-				hasContent = hasContent || len(groups.RepoOther) > 0
+	// Remove the other declarations from the end, so that earlier offsets stay valid.
+	for i := len(block.others) - 1; i >= 0; i-- {
+		code = removeLines(code, block.others[i][0], block.others[i][1])
+	}
 
-				// 6. Project-specific pkg packages - important: these come before internal.
-				writeImportGroup(groups.ProjectPkg, hasContent)
-				hasContent = hasContent || len(groups.ProjectPkg) > 0
+	// Drop the whole declaration if no imports are left.
+	if len(sections) == 0 {
+		return removeLines(code, lineStart(code, block.start), lineEnd(code, block.rparen)), nil
+	}
 
-				// 7. Project-specific internal packages.
-				writeImportGroup(groups.ProjectInternal, hasContent)
-			} else {
-				// Skip additional import blocks.
-				skipImportLines = true
-			}
-			continue
+	// Imports are indented one level deeper than the import keyword.
+	indent := string(code[lineStart(code, block.start):block.start])
+	indent = indent[:len(indent)-len(strings.TrimLeft(indent, " \t"))]
+
+	// A single import stays one, more are turned into a block.
+	if block.lparen < 0 {
+		var buf bytes.Buffer
+		buf.Write(code[:block.start])
+		if len(sections) == 1 && len(sections[0]) == 1 && sections[0][0].Doc == "" {
+			buf.WriteString("import " + importLine(sections[0][0]))
+		} else {
+			buf.WriteString("import (\n")
+			writeSections(&buf, indent, sections)
+			buf.WriteString(indent + ")")
 		}
+		buf.Write(code[block.rparen:])
+		return buf.Bytes(), nil
+	}
+	lparen, rparen := block.lparen, block.rparen
 
-		// End of an import block.
-		if inImportBlock && trimmedLine == ")" {
-			inImportBlock = false
-			buf.WriteString(line + "\n")
-			continue
-		}
+	// The imports start on the line after "import (", unless the first one follows it on the same line.
+	start, opening := lparen+1, "\n"
+	if i := bytes.IndexByte(code[lparen:rparen], '\n'); i >= 0 && !block.inline {
+		start, opening = lparen+i+1, ""
+	}
 
-		// Skip lines inside additional import blocks.
-		if skipImportLines {
-			if trimmedLine == ")" {
-				skipImportLines = false
-			}
-			continue
-		}
+	// The imports end before the line of ")".
+	end := lineStart(code, rparen)
+	closing := ""
+	switch {
+	case block.kept >= 0:
+		// Comments after the last import stay in place, like gofmt without a blank line before them.
+		end = lineStart(code, block.kept)
+	case end <= start || strings.TrimSpace(string(code[end:rparen])) != "":
+		// The closing parenthesis follows the last import on the same line.
+		end = rparen
+		closing = indent
+	}
 
-		// Skip lines inside the first import block (already processed).
-		if inImportBlock {
-			continue
-		}
+	var buf bytes.Buffer
+	buf.Write(code[:start])
+	buf.WriteString(opening)
+	writeSections(&buf, indent, sections)
+	buf.WriteString(closing)
+	buf.Write(code[end:])
+	return buf.Bytes(), nil
+}
 
-		// Write all other lines.
-		buf.WriteString(line + "\n")
+// removeLines removes the lines between two offsets together with the blank line following them.
+func removeLines(code []byte, start, end int) []byte {
+	if end < len(code) && code[end] == '\n' {
+		end++
 	}
 
-	err := scanner.Err()
+	out := make([]byte, 0, len(code)-(end-start))
+	out = append(out, code[:start]...)
+	return append(out, code[end:]...)
+}
+
+// insertImportBlock adds an import declaration after the package clause of a file without one.
+func insertImportBlock(code []byte, sections [][]entities.Import) ([]byte, error) {
+	if len(sections) == 0 {
+		return code, nil
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, parser.PackageClauseOnly)
 	if err != nil {
-		return nil, errors.Wrap(err, "scanning file")
+		return nil, errors.Wrap(err, "parsing package clause")
+	}
+
+	// Insert after the line of the package clause.
+	insert := len(code)
+	if i := bytes.IndexByte(code[fset.Position(file.Name.End()).Offset:], '\n'); i >= 0 {
+		insert = fset.Position(file.Name.End()).Offset + i + 1
 	}
 
+	var buf bytes.Buffer
+	buf.Write(code[:insert])
+	if insert == len(code) && !bytes.HasSuffix(code, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\nimport (\n")
+	writeSections(&buf, "", sections)
+	buf.WriteString(")\n")
+	buf.Write(code[insert:])
 	return buf.Bytes(), nil
 }
+
+// writeSections writes import sections separated by blank lines, keeping the comments of each import.
+func writeSections(buf *bytes.Buffer, indent string, sections [][]entities.Import) {
+	for i, section := range sections {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		for _, imp := range section {
+			if imp.Doc != "" {
+				for _, line := range strings.Split(imp.Doc, "\n") {
+					if line == "" {
+						// Blank lines inside /*-style comments are not indented.
+						buf.WriteString("\n")
+						continue
+					}
+					buf.WriteString(fmt.Sprintf("%s\t%s\n", indent, line))
+				}
+			}
+
+			buf.WriteString(fmt.Sprintf("%s\t%s\n", indent, importLine(imp)))
+		}
+	}
+}
+
+// importLine returns the import spec of an import, with its trailing comment.
+func importLine(imp entities.Import) string {
+	line := fmt.Sprintf("%q", imp.Path)
+	if imp.Alias != "" {
+		line = imp.Alias + " " + line
+	}
+	if imp.Comment != "" {
+		line += " " + imp.Comment
+	}
+	return line
+}
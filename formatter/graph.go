@@ -0,0 +1,183 @@
+package formatter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/entities"
+)
+
+// Levels of import graphs.
+const (
+	GraphPackage = "package" // Nodes are packages.
+	GraphProject = "project" // Nodes are projects; other packages are collapsed to their group.
+	GraphGroup   = "group"   // Nodes are import groups, relative to the importing file's project.
+)
+
+// Output formats of import graphs.
+const (
+	GraphDOT     = "dot"
+	GraphJSON    = "json"
+	GraphMermaid = "mermaid"
+)
+
+// BuildGraph aggregates the imports of the files of cfg into a dependency graph at a level.
+// Standard library packages are left out unless stdlib is set, and so are files outside a module,
+// whose package is unknown. Edges are weighted by the number of imports.
+func BuildGraph(cfg *config.Config, level string, stdlib bool) (*entities.Graph, error) {
+	switch level {
+	case GraphPackage, GraphProject, GraphGroup:
+	default:
+		return nil, errors.Errorf("unknown graph level %q, use %s, %s or %s", level, GraphPackage, GraphProject, GraphGroup)
+	}
+
+	nodes := make(map[string]bool)
+	counts := make(map[entities.GraphEdge]int)
+	handle := func(path string) error {
+		repo, err := cfg.RepoFor(path)
+		if err != nil {
+			return errors.Wrap(err, "resolving config")
+		}
+
+		code, err := os.ReadFile(path)
+		if err == nil {
+			var imports []entities.Import
+			imports, err = AllImports(code)
+			if err == nil {
+				addGraphEdges(nodes, counts, path, imports, repo, level, stdlib)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", path, err)
+		}
+		return nil
+	}
+
+	err := walkGoFiles(cfg, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &entities.Graph{Nodes: []string{}, Edges: []entities.GraphEdge{}}
+	for node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Strings(graph.Nodes)
+	for edge, count := range counts {
+		edge.Count = count
+		graph.Edges = append(graph.Edges, edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph, nil
+}
+
+// addGraphEdges counts the edges from the package of a file to its imports.
+func addGraphEdges(
+	nodes map[string]bool,
+	counts map[entities.GraphEdge]int,
+	filename string,
+	imports []entities.Import,
+	repo *entities.RepoConfig,
+	level string,
+	stdlib bool,
+) {
+	mod := fileModule(filename)
+	pkgPath := PackagePath(filename, mod)
+	if pkgPath == "" {
+		return
+	}
+
+	project := CurrentProject(filename, repo, mod)
+	from := graphNode(pkgPath, level, repo, mod, project)
+	nodes[from] = true
+
+	for _, imp := range imports {
+		if imp.Path == "C" || (!stdlib && pathGroup(imp.Path, repo, mod, project) == entities.GroupStdlib) {
+			continue
+		}
+
+		to := graphNode(imp.Path, level, repo, mod, project)
+		if to == from {
+			continue
+		}
+		nodes[to] = true
+		counts[entities.GraphEdge{From: from, To: to}]++
+	}
+}
+
+// graphNode returns the node of a package at a graph level, for a file of a project (nil if none).
+func graphNode(
+	importPath, level string,
+	repo *entities.RepoConfig,
+	mod *entities.Module,
+	project *entities.Project,
+) string {
+	switch level {
+	case GraphProject:
+		if p := MatchProject(importPath, repo); p != nil {
+			return projectLabel(p)
+		}
+		return pathGroup(importPath, repo, mod, nil)
+	case GraphGroup:
+		return pathGroup(importPath, repo, mod, project)
+	default:
+		return importPath
+	}
+}
+
+// projectLabel names a project by its domain and name, e.g. "health/steps".
+func projectLabel(project *entities.Project) string {
+	if project.Domain != "" {
+		return project.Domain + "/" + project.Name
+	}
+	return project.Name
+}
+
+// WriteGraph writes an import graph as Graphviz DOT, JSON or a Mermaid flowchart.
+func WriteGraph(w io.Writer, format string, graph *entities.Graph) error {
+	var b strings.Builder
+	switch format {
+	case GraphDOT:
+		b.WriteString("digraph imports {\n\trankdir=LR;\n\tnode [shape=box];\n")
+		for _, node := range graph.Nodes {
+			fmt.Fprintf(&b, "\t%s;\n", strconv.Quote(node))
+		}
+		for _, edge := range graph.Edges {
+			fmt.Fprintf(&b, "\t%s -> %s [label=%d];\n", strconv.Quote(edge.From), strconv.Quote(edge.To), edge.Count)
+		}
+		b.WriteString("}\n")
+
+	case GraphJSON:
+		return writeJSON(w, graph)
+
+	case GraphMermaid:
+		// Mermaid node IDs can't contain path characters, so nodes are numbered and labelled.
+		ids := make(map[string]string, len(graph.Nodes))
+		b.WriteString("graph LR\n")
+		for i, node := range graph.Nodes {
+			ids[node] = "n" + strconv.Itoa(i)
+			fmt.Fprintf(&b, "    %s[%s]\n", ids[node], strconv.Quote(node))
+		}
+		for _, edge := range graph.Edges {
+			fmt.Fprintf(&b, "    %s -->|%d| %s\n", ids[edge.From], edge.Count, ids[edge.To])
+		}
+
+	default:
+		return errors.Errorf("unknown graph format %q, use %s, %s or %s", format, GraphDOT, GraphJSON, GraphMermaid)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return errors.Wrap(err, "writing graph")
+}
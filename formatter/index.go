@@ -0,0 +1,183 @@
+package formatter
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"goimporter/entities"
+)
+
+// Ranks of package sources, lower is preferred.
+const (
+	rankStdlib = iota
+	rankModule
+	rankDependency
+)
+
+// indexedPackage is an importable package found by the package index.
+type indexedPackage struct {
+	path string // Import path.
+	dir  string // Source directory.
+	rank int    // Rank of the package source.
+}
+
+var (
+	// stdlibIndex lists the standard library packages by name.
+	stdlibIndex     map[string][]indexedPackage
+	stdlibIndexOnce sync.Once
+
+	// moduleIndexes lists the packages of modules and their dependencies by name, by module directory.
+	moduleIndexesMu sync.Mutex
+	moduleIndexes   = make(map[string]map[string][]indexedPackage)
+
+	// packageExports caches the exported names of packages by directory.
+	packageExports sync.Map
+)
+
+// findPackages returns the packages with a name importable by a file of the module,
+// from the standard library, the module itself and its go.mod dependencies.
+func findPackages(name string, mod *entities.Module) []indexedPackage {
+	stdlibIndexOnce.Do(func() {
+		stdlibIndex = make(map[string][]indexedPackage)
+		indexTree(stdlibIndex, filepath.Join(build.Default.GOROOT, "src"), "", rankStdlib)
+	})
+
+	found := append([]indexedPackage(nil), stdlibIndex[name]...)
+	if mod != nil {
+		found = append(found, moduleIndex(mod)[name]...)
+	}
+	return found
+}
+
+// moduleIndex indexes the packages of a module and of the modules it requires.
+func moduleIndex(mod *entities.Module) map[string][]indexedPackage {
+	moduleIndexesMu.Lock()
+	defer moduleIndexesMu.Unlock()
+
+	if index, ok := moduleIndexes[mod.Dir]; ok {
+		return index
+	}
+
+	index := make(map[string][]indexedPackage)
+	if mod.Path != "" {
+		indexTree(index, mod.Dir, mod.Path, rankModule)
+	}
+	for _, r := range mod.Requires {
+		if dir := packageDir(r.Path, mod); dir != "" {
+			indexTree(index, dir, r.Path, rankDependency)
+		}
+	}
+
+	moduleIndexes[mod.Dir] = index
+	return index
+}
+
+// indexTree adds the packages in a directory tree to an index. Vendor, testdata and hidden
+// directories and nested modules are skipped.
+func indexTree(index map[string][]indexedPackage, root, rootPath string, rank int) {
+	_ = filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, dir)
+		if rel != "." {
+			base := d.Name()
+			if base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		// Internal and command packages of the standard library can't be imported.
+		importPath := path.Join(rootPath, filepath.ToSlash(rel))
+		if rank == rankStdlib &&
+			(rel == "." || isInternal(importPath) || importPath == "cmd" || strings.HasPrefix(importPath, "cmd/")) {
+			return nil
+		}
+
+		if name := readPackageName(dir); name != "" && name != "main" {
+			index[name] = append(index[name], indexedPackage{path: importPath, dir: dir, rank: rank})
+		}
+		return nil
+	})
+}
+
+// exportedNames returns the exported top-level names of the package in a directory.
+func exportedNames(dir string) map[string]bool {
+	if names, ok := packageExports.Load(dir); ok {
+		return names.(map[string]bool)
+	}
+
+	names := make(map[string]bool)
+	for _, name := range packageLevelNames(dir, "", "") {
+		if ast.IsExported(name) {
+			names[name] = true
+		}
+	}
+
+	packageExports.Store(dir, names)
+	return names
+}
+
+// packageLevelNames returns the top-level names declared by the Go files in a directory, skipping
+// one file and, if a package name is given, files of other packages. Test files are included only
+// if the skipped file is one, since only tests see their declarations.
+func packageLevelNames(dir, skip, pkgName string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	tests := strings.HasSuffix(skip, "_test.go")
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || name == skip ||
+			(!tests && strings.HasSuffix(name, "_test.go")) {
+			continue
+		}
+
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil || (pkgName != "" && file.Name.Name != pkgName) {
+			continue
+		}
+		names = append(names, topLevelNames(file)...)
+	}
+	return names
+}
+
+// topLevelNames returns the names of a file's top-level declarations, except methods.
+func topLevelNames(file *ast.File) []string {
+	var names []string
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				names = append(names, decl.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, ident := range spec.Names {
+						names = append(names, ident.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
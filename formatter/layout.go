@@ -0,0 +1,170 @@
+package formatter
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"goimporter/entities"
+)
+
+// Placeholders of project layout templates. The legacy %s stands for {project}.
+const (
+	domainPlaceholder  = "{domain}"
+	projectPlaceholder = "{project}"
+	legacyPlaceholder  = "%s"
+)
+
+// domainPkgProject is the project name of domain-wide packages (e.g. projects/health/pkg).
+const domainPkgProject = "pkg"
+
+// projectLayout is a compiled project layout template.
+type projectLayout struct {
+	importPath *regexp.Regexp // Matches import paths inside a project.
+	filePath   *regexp.Regexp // Matches file paths containing a project, e.g. GOPATH-style checkouts.
+	domain     string         // Fixed domain of templates without a {domain} placeholder.
+}
+
+// placeholders matches the placeholders of a project layout template.
+var placeholders = regexp.MustCompile(`\{domain\}|\{project\}`)
+
+// layouts caches compiled project layouts by template.
+var layouts sync.Map
+
+// projectTemplates returns all project layout templates of a repository configuration.
+func projectTemplates(repo *entities.RepoConfig) []string {
+	var templates []string
+	if repo.ProjectsTemplate != "" {
+		templates = append(templates, repo.ProjectsTemplate)
+	}
+	return append(templates, repo.ProjectsTemplates...)
+}
+
+// compileLayout compiles a project layout template into regular expressions.
+func compileLayout(original string) *projectLayout {
+	if layout, ok := layouts.Load(original); ok {
+		return layout.(*projectLayout)
+	}
+
+	template := strings.ReplaceAll(original, legacyPlaceholder, projectPlaceholder)
+
+	var pattern strings.Builder
+	last := 0
+	for _, loc := range placeholders.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		switch template[loc[0]:loc[1]] {
+		case domainPlaceholder:
+			pattern.WriteString(`(?P<domain>[^/]+)`)
+		case projectPlaceholder:
+			pattern.WriteString(`(?P<project>[^/]+)`)
+		}
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+
+	layout := &projectLayout{
+		importPath: regexp.MustCompile(`^` + pattern.String() + `(?:/|$)`),
+		filePath:   regexp.MustCompile(`(?:^|/)` + pattern.String() + `/`),
+	}
+	if !strings.Contains(template, domainPlaceholder) {
+		layout.domain = extractDomainFromTemplate(template)
+	}
+
+	layouts.Store(original, layout)
+	return layout
+}
+
+// match returns the project a path belongs to, or nil if the layout doesn't match.
+func (l *projectLayout) match(re *regexp.Regexp, path string) *entities.Project {
+	loc := re.FindStringSubmatchIndex(path)
+	if loc == nil {
+		return nil
+	}
+
+	project := &entities.Project{Domain: l.domain}
+	for i, name := range re.SubexpNames() {
+		if loc[2*i] < 0 {
+			continue
+		}
+		switch name {
+		case "domain":
+			project.Domain = path[loc[2*i]:loc[2*i+1]]
+		case "project":
+			project.Name = path[loc[2*i]:loc[2*i+1]]
+			project.Root = strings.TrimPrefix(path[loc[0]:loc[2*i+1]], "/")
+		}
+	}
+	if project.Name == "" {
+		return nil
+	}
+	return project
+}
+
+// matchProject returns the project or domain pkg directory an import path belongs to,
+// trying each layout template in order.
+func matchProject(path string, repo *entities.RepoConfig) *entities.Project {
+	for _, template := range projectTemplates(repo) {
+		layout := compileLayout(template)
+		if project := layout.match(layout.importPath, path); project != nil {
+			return project
+		}
+	}
+	return nil
+}
+
+// MatchProject returns the project an import path belongs to, or nil if it is not inside a project.
+func MatchProject(path string, repo *entities.RepoConfig) *entities.Project {
+	project := matchProject(path, repo)
+	if project == nil || project.Name == domainPkgProject {
+		return nil
+	}
+	return project
+}
+
+// isDomainPkg checks if an import path is inside a domain-wide pkg directory of a project layout,
+// e.g. "projects/payments/pkg/money" for the template "projects/{domain}/{project}".
+func isDomainPkg(path string, repo *entities.RepoConfig) bool {
+	project := matchProject(path, repo)
+	return project != nil && project.Name == domainPkgProject
+}
+
+// extractProject returns the project a file path belongs to, or nil if it is not inside a project.
+func extractProject(filePath string, repo *entities.RepoConfig) *entities.Project {
+	filePath = filepath.ToSlash(filePath)
+	for _, template := range projectTemplates(repo) {
+		layout := compileLayout(template)
+		if project := layout.match(layout.filePath, filePath); project != nil {
+			if project.Name == domainPkgProject {
+				return nil
+			}
+			return project
+		}
+	}
+	return nil
+}
+
+// CurrentProject returns the project a file belongs to, detected from the import path of its package
+// and, if that is unknown, from the file path. It returns nil if the file is not inside a project.
+func CurrentProject(filename string, repo *entities.RepoConfig, mod *entities.Module) *entities.Project {
+	if pkgPath := PackagePath(filename, mod); pkgPath != "" {
+		if project := MatchProject(pkgPath, repo); project != nil {
+			return project
+		}
+	}
+	return extractProject(filename, repo)
+}
+
+// GuessProject guesses the current project from the first project pkg or internal import.
+// It is a fallback for files whose location doesn't tell their project, e.g. files outside a module.
+func GuessProject(imports []entities.Import, repo *entities.RepoConfig) *entities.Project {
+	for _, imp := range imports {
+		if !strings.Contains(imp.Path, "/internal/") && !strings.Contains(imp.Path, "/pkg/") {
+			continue
+		}
+		if project := MatchProject(imp.Path, repo); project != nil {
+			return project
+		}
+	}
+	return nil
+}
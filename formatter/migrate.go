@@ -0,0 +1,147 @@
+package formatter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/entities"
+)
+
+// MigrateGoFiles moves the import paths below one prefix to another in every Go file of cfg, e.g. after
+// moving a package or renaming a module. Generated and mock files are migrated too, since they would no
+// longer build otherwise, but only the other files are regrouped. Aliases are kept and uses of packages
+// whose name changes are renamed; files without matching imports are left untouched.
+func MigrateGoFiles(cfg *config.Config, from, to string) error {
+	from, to = strings.TrimSuffix(from, "/"), strings.TrimSuffix(to, "/")
+	if from == "" || to == "" {
+		return errors.New("migration needs both a from and a to prefix")
+	}
+
+	migrating := *cfg
+	migrating.Migrations = append(slices.Clip(cfg.Migrations), entities.ImportRule{
+		Path:        from + "/...",
+		Replacement: to + "/...",
+	})
+	migrating.ExcludeMock = false
+	migrating.Tags, migrating.GOOS, migrating.GOARCH = nil, "", ""
+
+	handle := func(path string) error {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error processing %s: %v\n", path, err)
+			return nil
+		}
+
+		file, err := parser.ParseFile(token.NewFileSet(), path, code, parser.ImportsOnly)
+		if err == nil && !slices.ContainsFunc(file.Imports, func(spec *ast.ImportSpec) bool {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			rule, _ := matchImportRule(importPath, migrating.Migrations)
+			return rule != nil
+		}) {
+			return nil
+		}
+
+		err = ProcessFile(path, &migrating)
+		if isConfigError(err) {
+			return err
+		}
+		if err != nil {
+			fmt.Printf("Error processing %s: %v\n", path, err)
+		}
+		return nil
+	}
+
+	return walkGoFiles(&migrating, handle)
+}
+
+// MigrateImports moves the imports of a file's code matched by migration rules to their replacement
+// path, in every import declaration and leaving their layout alone. Uses of a package whose name
+// changes are renamed, unless the new name is taken or either name is shadowed by a declaration of
+// the file; the old name is then kept as an alias.
+func MigrateImports(filename string, code []byte, rules []entities.ImportRule, mod *entities.Module) ([]byte, error) {
+	fset, file, err := parseResolved(filename, code)
+	if err != nil {
+		return nil, err
+	}
+	shadowed := shadowedNames(file)
+
+	// Names that a moved import must not take.
+	taken := make(map[string]bool)
+	for _, spec := range file.Imports {
+		taken[specName(spec, mod)] = true
+	}
+	for _, name := range declaredNames(file) {
+		taken[name] = true
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	renames := make(map[string]string)
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		_, replacement := matchImportRule(importPath, rules)
+		if replacement == "" {
+			continue
+		}
+
+		text := strconv.Quote(replacement)
+		if spec.Name == nil {
+			oldName, newName := PackageName(importPath, mod), PackageName(replacement, mod)
+			switch {
+			case oldName == newName || renames[oldName] == newName:
+			case taken[newName] || shadowedName(shadowed, oldName, newName) != "" || renames[oldName] != "":
+				text = oldName + " " + text
+			default:
+				taken[newName] = true
+				renames[oldName] = newName
+			}
+		}
+		edits = append(edits, edit{
+			start: fset.Position(spec.Path.Pos()).Offset,
+			end:   fset.Position(spec.Path.End()).Offset,
+			text:  text,
+		})
+	}
+	if len(edits) == 0 {
+		return code, nil
+	}
+
+	// Selectors follow the import declarations, so renaming them keeps the import offsets valid.
+	out := rewriteFileSelectors(fset, file, code, func(pkg, name string) (string, bool) {
+		renamed, ok := renames[pkg]
+		return renamed + "." + name, ok
+	})
+
+	// Edit from the end so earlier offsets stay valid.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+	return out, nil
+}
+
+// specName returns the name an import spec binds, like ImportName.
+func specName(spec *ast.ImportSpec, mod *entities.Module) string {
+	imp := entities.Import{}
+	imp.Path, _ = strconv.Unquote(spec.Path.Value)
+	if spec.Name != nil {
+		imp.Alias = spec.Name.Name
+	}
+	return ImportName(imp, mod)
+}
@@ -0,0 +1,190 @@
+package formatter
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"goimporter/entities"
+)
+
+// AddMissing adds imports for the package selectors of a file that don't resolve to an import
+// or a declaration, such as strings in strings.ToUpper. Candidates are looked up in the standard
+// library, the module's own packages and its go.mod dependencies; those exporting every selected
+// name are preferred, then standard library packages, then the module's own, then shorter paths.
+func AddMissing(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	mod *entities.Module,
+) ([]entities.Import, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, code, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing file")
+	}
+
+	// Names already taken by imports, including those outside the grouped block, and declarations.
+	known := make(map[string]bool)
+	for _, imp := range imports {
+		known[ImportName(imp, mod)] = true
+	}
+	for _, spec := range file.Imports {
+		imp := entities.Import{Path: strings.Trim(spec.Path.Value, "`\"")}
+		if spec.Name != nil {
+			imp.Alias = spec.Name.Name
+		}
+		known[ImportName(imp, mod)] = true
+	}
+	for _, name := range declaredNames(file) {
+		known[name] = true
+	}
+	for _, name := range packageLevelNames(filepath.Dir(filename), filepath.Base(filename), file.Name.Name) {
+		known[name] = true
+	}
+
+	// Selected names of each unresolved package name.
+	missing := make(map[string]map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok || known[ident.Name] || ident.Name == "C" || ident.Name == "_" {
+			return true
+		}
+		if missing[ident.Name] == nil {
+			missing[ident.Name] = make(map[string]bool)
+		}
+		missing[ident.Name][sel.Sel.Name] = true
+		return true
+	})
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pkgPath := PackagePath(filename, mod)
+	for _, name := range names {
+		best, ok := bestPackage(findPackages(name, mod), missing[name], pkgPath)
+		if !ok {
+			continue
+		}
+
+		imp := entities.Import{Path: best.path}
+		if assumedPackageName(best.path) != name {
+			// Name packages whose name can't be told from the import path.
+			imp.Alias = name
+		}
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+// bestPackage picks the candidate package to import for a set of selected names.
+func bestPackage(candidates []indexedPackage, selected map[string]bool, pkgPath string) (indexedPackage, bool) {
+	var matching []indexedPackage
+	for _, candidate := range candidates {
+		if candidate.path == pkgPath || !canImport(pkgPath, candidate.path) {
+			continue
+		}
+
+		exports := exportedNames(candidate.dir)
+		exportsAll := true
+		for name := range selected {
+			if !exports[name] {
+				exportsAll = false
+				break
+			}
+		}
+		if exportsAll {
+			matching = append(matching, candidate)
+		}
+	}
+	if len(matching) == 0 {
+		return indexedPackage{}, false
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		switch {
+		case a.rank != b.rank:
+			return a.rank < b.rank
+		case len(a.path) != len(b.path):
+			return len(a.path) < len(b.path)
+		default:
+			return a.path < b.path
+		}
+	})
+	return matching[0], true
+}
+
+// canImport checks the internal package rule: a package under internal/ can only be imported
+// from the tree rooted at the parent of internal. Files of unknown packages can import anything.
+func canImport(importer, importPath string) bool {
+	elems := strings.Split(importPath, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		if elems[i] != "internal" {
+			continue
+		}
+		parent := path.Join(elems[:i]...)
+		return importer == "" || importer == parent || strings.HasPrefix(importer, parent+"/")
+	}
+	return true
+}
+
+// isInternal checks if an import path has an internal element.
+func isInternal(importPath string) bool {
+	return importPath == "internal" || strings.HasPrefix(importPath, "internal/") ||
+		strings.Contains(importPath, "/internal/") || strings.HasSuffix(importPath, "/internal")
+}
+
+// declaredNames returns all names declared in a file at any scope. Scopes are ignored,
+// so a local variable named like a package prevents adding an import for it.
+func declaredNames(file *ast.File) []string {
+	var names []string
+	addIdents := func(exprs ...ast.Expr) {
+		for _, expr := range exprs {
+			if ident, ok := expr.(*ast.Ident); ok {
+				names = append(names, ident.Name)
+			}
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			names = append(names, n.Name.Name)
+		case *ast.Field:
+			for _, ident := range n.Names {
+				names = append(names, ident.Name)
+			}
+		case *ast.ValueSpec:
+			for _, ident := range n.Names {
+				names = append(names, ident.Name)
+			}
+		case *ast.TypeSpec:
+			names = append(names, n.Name.Name)
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				addIdents(n.Lhs...)
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				addIdents(n.Key, n.Value)
+			}
+		case *ast.LabeledStmt:
+			names = append(names, n.Label.Name)
+		}
+		return true
+	})
+	return names
+}
@@ -0,0 +1,123 @@
+package formatter
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+
+	"goimporter/entities"
+)
+
+var (
+	modulesMu sync.Mutex
+	modules   = make(map[string]*entities.Module)
+)
+
+// FindModule locates the go.mod governing a file and parses it.
+// It returns nil if the file does not belong to any module.
+func FindModule(filename string) (*entities.Module, error) {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving path")
+	}
+
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		modPath := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(modPath); err == nil {
+			return loadModule(modPath)
+		}
+
+		if filepath.Dir(dir) == dir {
+			return nil, nil
+		}
+	}
+}
+
+// fileModule is FindModule for grouping: a go.mod that can't be loaded is treated like a missing
+// one, so the file is still formatted, only without module, sibling or project information.
+func fileModule(filename string) *entities.Module {
+	mod, err := FindModule(filename)
+	if err != nil {
+		return nil
+	}
+	return mod
+}
+
+// loadModule parses a go.mod file, caching the result.
+func loadModule(modPath string) (*entities.Module, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	if mod, ok := modules[modPath]; ok {
+		return mod, nil
+	}
+
+	data, err := os.ReadFile(modPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading go.mod")
+	}
+
+	file, err := modfile.Parse(modPath, data, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing go.mod")
+	}
+
+	mod := &entities.Module{Dir: filepath.Dir(modPath)}
+	if file.Module != nil {
+		mod.Path = file.Module.Mod.Path
+	}
+
+	for _, r := range file.Replace {
+		mod.Replaces = append(mod.Replaces, entities.Replace{
+			Old:        r.Old.Path,
+			New:        r.New.Path,
+			NewVersion: r.New.Version,
+			Local:      modfile.IsDirectoryPath(r.New.Path),
+		})
+	}
+
+	for _, r := range file.Require {
+		mod.Requires = append(mod.Requires, entities.Require{Path: r.Mod.Path, Version: r.Mod.Version})
+	}
+
+	modules[modPath] = mod
+	return mod, nil
+}
+
+// PackagePath returns the import path of the package containing a file,
+// or an empty string if the file is outside the module.
+func PackagePath(filename string, mod *entities.Module) string {
+	if mod == nil || mod.Path == "" {
+		return ""
+	}
+
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return ""
+	}
+
+	rel, err := filepath.Rel(mod.Dir, filepath.Dir(absPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return path.Join(mod.Path, filepath.ToSlash(rel))
+}
+
+// isReplaced checks if an import path belongs to a module replaced in go.mod.
+func isReplaced(importPath string, mod *entities.Module) bool {
+	if mod == nil {
+		return false
+	}
+
+	for _, r := range mod.Replaces {
+		if importPath == r.Old || strings.HasPrefix(importPath, r.Old+"/") {
+			return true
+		}
+	}
+	return false
+}
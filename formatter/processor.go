@@ -3,6 +3,7 @@ package formatter
 import (
 	"bytes"
 	"fmt"
+	"go/build"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 
 	"goimporter/config"
+	"goimporter/entities"
 )
 
 // ProcessFile organizes imports in a single Go file.
@@ -20,59 +22,392 @@ func ProcessFile(filename string, cfg *config.Config) error {
 		return errors.Wrap(err, "reading file")
 	}
 
-	// Check if this is a generated file - if so, skip it.
-	if IsGeneratedFile(code) {
+	// Resolve the repository configuration for this file.
+	repo, err := cfg.RepoFor(filename)
+	if err != nil {
+		return errors.Wrap(err, "resolving config")
+	}
+
+	// Check if this is a generated file - if so, skip it, apart from migrating its imports
+	// since it would no longer build otherwise.
+	generated := skipGenerated(filename, code, repo, cfg)
+	var newContent []byte
+	var diagnostics []entities.Diagnostic
+	switch {
+	case generated && len(cfg.Migrations) > 0:
+		newContent, err = migrateFile(filename, code, cfg.Migrations)
+	case generated:
 		fmt.Printf("Skipping generated file: %s\n", filename)
 		return nil
+	default:
+		newContent, diagnostics, err = formatFile(filename, code, repo, cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Report the fixes left to do by hand.
+	for _, d := range diagnostics {
+		if d.Rule == RuleShadowedImport {
+			fmt.Println(d)
+		}
+	}
+
+	// Skip writing if content didn't change.
+	if bytes.Equal(code, newContent) {
+		return nil
+	}
+
+	// Only write changes if not in dry run or diff mode.
+	switch {
+	case cfg.Diff:
+		fmt.Print(Diff(filename, code, newContent))
+	case cfg.DryRun:
+		fmt.Printf("Would process: %s\n", filename)
+	default:
+		err := os.WriteFile(filename, newContent, 0o644)
+		if err != nil {
+			return errors.Wrap(err, "writing file")
+		}
+		fmt.Printf("Processed: %s\n", filename)
+	}
+
+	return nil
+}
+
+// CheckFile reports the problems of a single Go file without changing it:
+// imports that are not grouped and sorted, and import violations.
+// Generated files are skipped.
+func CheckFile(filename string, cfg *config.Config) ([]entities.Diagnostic, error) {
+	code, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading file")
+	}
+
+	result, err := CheckSource(filename, code, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return result.Diagnostics, nil
+}
+
+// CheckSource organizes the imports of a file's code and reports its problems like CheckFile,
+// without printing or writing anything. The file itself is not read, but its go.mod and the
+// packages it imports may be, to resolve package names. Generated files are skipped.
+func CheckSource(filename string, code []byte, cfg *config.Config) (*entities.FileResult, error) {
+	repo, err := cfg.RepoFor(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving config")
+	}
+
+	result := &entities.FileResult{File: filename, Source: code}
+	if skipGenerated(filename, code, repo, cfg) {
+		result.Skipped = true
+		return result, nil
+	}
+
+	newContent, diagnostics, err := formatFile(filename, code, repo, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(code, newContent) {
+		result.Source, result.Changed = newContent, true
+		diagnostics = append([]entities.Diagnostic{{
+			File:    filename,
+			Rule:    RuleUnsorted,
+			Message: "imports are not grouped and sorted",
+		}}, diagnostics...)
+	}
+	result.Diagnostics = diagnostics
+	return result, nil
+}
+
+// migrateFile moves the import paths of a file's code matched by migration rules, see MigrateImports.
+func migrateFile(filename string, code []byte, migrations []entities.ImportRule) ([]byte, error) {
+	code, err := MigrateImports(filename, code, migrations, fileModule(filename))
+	if err != nil {
+		return nil, errors.Wrap(err, "migrating imports")
+	}
+	return code, nil
+}
+
+// skipGenerated checks if a file is generated and not included with -include-generated
+// or by its generator.
+func skipGenerated(filename string, code []byte, repo *entities.RepoConfig, cfg *config.Config) bool {
+	if cfg.IncludeGenerated || !IsGenerated(filename, code, repo) {
+		return false
+	}
+
+	return !includedGenerator(code, repo)
+}
+
+// includedGenerator checks if a file's code was generated by a generator listed in include_generated.
+func includedGenerator(code []byte, repo *entities.RepoConfig) bool {
+	generator := GeneratorName(code)
+	for _, included := range repo.IncludeGenerated {
+		if generator != "" && strings.EqualFold(generator, included) {
+			return true
+		}
 	}
+	return false
+}
+
+// includedMock checks if a file excluded as a mock with -exclude-mock was generated by a generator
+// listed in include_generated, like mockgen, and is formatted anyway. Files whose config can't be
+// resolved or that can't be read are left excluded.
+func includedMock(cfg *config.Config, path string) bool {
+	repo, err := cfg.RepoFor(path)
+	if err != nil || len(repo.IncludeGenerated) == 0 {
+		return false
+	}
+	code, err := os.ReadFile(path)
+	return err == nil && includedGenerator(code, repo)
+}
 
+// formatFile organizes the imports of a file's code and checks them for violations.
+func formatFile(
+	filename string,
+	code []byte,
+	repo *entities.RepoConfig,
+	cfg *config.Config,
+) ([]byte, []entities.Diagnostic, error) {
 	// Get prefixes for this file.
-	prefixes := GetImportPrefixes(filename, cfg.Repo)
+	prefixes := GetImportPrefixes(filename, repo)
 	if len(cfg.PkgPrefixes) > 0 {
 		prefixes = cfg.PkgPrefixes
 	}
 
+	// Add missing //go:build lines if requested.
+	if cfg.NormalizeBuild {
+		var err error
+		code, err = NormalizeBuildConstraints(code)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "normalizing build constraints")
+		}
+	}
+
+	// Move the import paths of a migration, in every import declaration.
+	if len(cfg.Migrations) > 0 {
+		var err error
+		code, err = migrateFile(filename, code, cfg.Migrations)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Collect all imports from the file.
 	allImports, err := CollectImports(code)
 	if err != nil {
-		return errors.Wrap(err, "collecting imports")
+		return nil, nil, errors.Wrap(err, "collecting imports")
+	}
+
+	// Find the module to honour its replace directives.
+	mod := fileModule(filename)
+
+	// Add imports for unresolved packages if requested.
+	if cfg.AddMissing {
+		allImports, err = AddMissing(filename, code, allImports, mod)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "adding missing imports")
+		}
 	}
 
-	// If no imports were found, nothing to do.
+	// If no imports were found, nothing else to do.
 	if len(allImports) == 0 {
-		return nil
+		return code, nil, nil
+	}
+
+	// Drop unused imports if requested.
+	if cfg.RemoveUnused {
+		allImports, err = RemoveUnused(filename, code, allImports, mod)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "removing unused imports")
+		}
+	}
+
+	// Fixes that can't be applied safely are reported.
+	var refused, more []finding
+
+	// Replace deprecated imports and apply the alias policy if requested.
+	if cfg.Fix {
+		code, allImports, refused, err = fixImportRules(filename, code, allImports, repo.ImportRules, mod)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "replacing deprecated imports")
+		}
+
+		code, allImports, more, err = fixAliases(filename, code, allImports, repo.AliasPolicy, cfg.ImportNames, mod)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "fixing aliases")
+		}
+		refused = append(refused, more...)
+	}
+	unfixed, err := findingDiagnostics(filename, code, refused)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "reporting refused fixes")
+	}
+
+	// Detect the current project from the file's location, guessing from its imports
+	// only if the location doesn't tell.
+	project := CurrentProject(filename, repo, mod)
+	if project == nil && PackagePath(filename, mod) == "" {
+		project = GuessProject(allImports, repo)
+	}
+
+	// Check imports for violations.
+	diagnostics, err := checkImports(filename, code, allImports, repo, mod, project, cfg.ImportNames)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "checking imports")
 	}
 
 	// Group imports and remove duplicates.
-	groups := GroupImports(allImports, prefixes, cfg.Repo)
+	groups := GroupImports(allImports, prefixes, repo, mod, project)
 
 	// Generate the new file content.
-	newContent, err := RewriteFile(code, groups)
+	newContent, err := RewriteFile(code, SectionImports(groups, repo.Sections))
 	if err != nil {
-		return errors.Wrap(err, "rewriting file")
+		return nil, nil, errors.Wrap(err, "rewriting file")
 	}
 
-	// Skip writing if content didn't change.
-	if bytes.Equal(code, newContent) {
+	return newContent, append(unfixed, diagnostics...), nil
+}
+
+// ProcessGoFiles processes all Go files in a directory or recursively.
+// In check mode, files are only checked and the problems found are printed in the
+// configured format; an error is returned if there are any.
+func ProcessGoFiles(cfg *config.Config) error {
+	// Consistent aliases need the names used across all files first.
+	if cfg.ImportNames == nil {
+		names, err := importNames(cfg)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			withNames := *cfg
+			withNames.ImportNames = names
+			cfg = &withNames
+		}
+	}
+
+	// Text diagnostics are printed as they are found, other formats once all files are checked.
+	streaming := !cfg.Check || cfg.Format == "" || cfg.Format == config.FormatText
+
+	problems := 0
+	var collected []entities.Diagnostic
+	handle := func(path string) error {
+		var err error
+		if cfg.Check {
+			var diagnostics []entities.Diagnostic
+			diagnostics, err = CheckFile(path, cfg)
+			if streaming {
+				for _, d := range diagnostics {
+					fmt.Println(d)
+				}
+			}
+			collected = append(collected, diagnostics...)
+			problems += len(diagnostics)
+		} else {
+			err = ProcessFile(path, cfg)
+		}
+
+		if isConfigError(err) {
+			return err
+		}
+		if err != nil {
+			// Keep structured output parseable.
+			out := os.Stdout
+			if !streaming {
+				out = os.Stderr
+			}
+			fmt.Fprintf(out, "Error processing %s: %v\n", path, err)
+		}
 		return nil
 	}
 
-	// Only write changes if not in dry run mode.
-	if !cfg.DryRun {
-		err := os.WriteFile(filename, newContent, 0o644)
+	err := walkGoFiles(cfg, handle)
+	if err != nil {
+		return err
+	}
+
+	if !streaming {
+		err = WriteDiagnostics(os.Stdout, cfg.Format, collected)
 		if err != nil {
-			return errors.Wrap(err, "writing file")
+			return err
 		}
-		fmt.Printf("Processed: %s\n", filename)
-	} else {
-		fmt.Printf("Would process: %s\n", filename)
 	}
 
+	if problems > 0 {
+		return errors.Errorf("%d import problems found", problems)
+	}
 	return nil
 }
 
-// ProcessGoFiles processes all Go files in a directory or recursively.
-func ProcessGoFiles(cfg *config.Config) error {
+// importNames returns the name each import path is imported by in most of the files of cfg whose
+// alias policy asks for consistent aliases, for the paths imported by more than one name.
+// Ties go to the alphabetically first name. Generated files are left out, like when processing.
+func importNames(cfg *config.Config) (map[string]string, error) {
+	counts := make(map[string]map[string]int)
+	handle := func(path string) error {
+		repo, err := cfg.RepoFor(path)
+		if err != nil {
+			return errors.Wrap(err, "resolving config")
+		}
+		if !repo.AliasPolicy.Consistent {
+			return nil
+		}
+
+		// Unreadable files are reported when processed.
+		code, err := os.ReadFile(path)
+		if err != nil || skipGenerated(path, code, repo, cfg) {
+			return nil
+		}
+		imports, err := AllImports(code)
+		if err != nil {
+			return nil
+		}
+		mod := fileModule(path)
+
+		for _, imp := range imports {
+			if imp.Alias == "_" || imp.Alias == "." || imp.Path == "C" {
+				continue
+			}
+			if counts[imp.Path] == nil {
+				counts[imp.Path] = make(map[string]int)
+			}
+			counts[imp.Path][ImportName(imp, mod)]++
+		}
+		return nil
+	}
+
+	err := walkGoFiles(cfg, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for importPath, byName := range counts {
+		if len(byName) > 1 {
+			names[importPath] = sortCounts(byName)[0].Name
+		}
+	}
+	return names, nil
+}
+
+// walkGoFiles calls handle for the files given as arguments, or for all Go files
+// in a directory or recursively. Walked files are restricted to the build context, if any.
+func walkGoFiles(cfg *config.Config, handle func(path string) error) error {
+	if len(cfg.Files) > 0 {
+		for _, path := range cfg.Files {
+			err := handle(path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx := cfg.BuildContext()
+
 	if cfg.Recursive {
 		err := filepath.WalkDir(cfg.Dir, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
@@ -80,14 +415,14 @@ func ProcessGoFiles(cfg *config.Config) error {
 			}
 
 			if !d.IsDir() && strings.HasSuffix(path, ".go") {
-				if cfg.ExcludeMock && strings.Contains(path, "mock") {
+				if cfg.ExcludeMock && strings.Contains(path, "mock") && !includedMock(cfg, path) {
 					return nil
 				}
-
-				err := ProcessFile(path, cfg)
-				if err != nil {
-					fmt.Printf("Error processing %s: %v\n", path, err)
+				if !matchBuildContext(ctx, path) {
+					return nil
 				}
+
+				return handle(path)
 			}
 			return nil
 		})
@@ -105,17 +440,42 @@ func ProcessGoFiles(cfg *config.Config) error {
 
 	for _, entry := range entries {
 		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
-			if cfg.ExcludeMock && strings.Contains(entry.Name(), "mock") {
+			path := filepath.Join(cfg.Dir, entry.Name())
+			if cfg.ExcludeMock && strings.Contains(entry.Name(), "mock") && !includedMock(cfg, path) {
 				continue
 			}
 
-			path := filepath.Join(cfg.Dir, entry.Name())
-			err := ProcessFile(path, cfg)
+			if !matchBuildContext(ctx, path) {
+				continue
+			}
+
+			err := handle(path)
 			if err != nil {
-				fmt.Printf("Error processing %s: %v\n", path, err)
+				return err
 			}
 		}
 	}
 
 	return nil
 }
+
+// matchBuildContext checks if a file matches the build context: its GOOS/GOARCH file name
+// suffixes and build constraints. Any file matches a nil context.
+func matchBuildContext(ctx *build.Context, path string) bool {
+	if ctx == nil {
+		return true
+	}
+
+	ok, err := ctx.MatchFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		// Let processing report unreadable files.
+		return true
+	}
+	return ok
+}
+
+// isConfigError checks if an error comes from a broken config, which must stop the run.
+func isConfigError(err error) bool {
+	var cfgErr config.Errors
+	return errors.As(err, &cfgErr)
+}
@@ -0,0 +1,135 @@
+package formatter
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// RenameSelectors renames the package of qualified identifiers in a file's code, e.g. with
+// {"yaml": "yamlv3"} yaml.Marshal becomes yamlv3.Marshal. Only identifiers referring to an
+// imported package are renamed, and the rest of the code is kept byte for byte. Renames whose
+// old or new name is declared in the file are refused, since part of the file may mean the
+// declaration by it.
+func RenameSelectors(filename string, code []byte, renames map[string]string) ([]byte, error) {
+	if len(renames) == 0 {
+		return code, nil
+	}
+
+	fset, file, err := parseResolved(filename, code)
+	if err != nil {
+		return nil, err
+	}
+	shadowed := shadowedNames(file)
+	for _, oldName := range slices.Sorted(maps.Keys(renames)) {
+		if name := shadowedName(shadowed, oldName, renames[oldName]); name != "" {
+			return nil, errors.Errorf("cannot rename %s to %s: %s is shadowed by a declaration", oldName, renames[oldName], name)
+		}
+	}
+
+	return rewriteFileSelectors(fset, file, code, func(pkg, name string) (string, bool) {
+		renamed, ok := renames[pkg]
+		return renamed + "." + name, ok
+	}), nil
+}
+
+// rewriteSelectors replaces the qualified identifiers in a file's code for which rewrite returns
+// a replacement, e.g. ioutil.ReadFile with os.ReadFile. Selectors on local declarations are left
+// alone. The rest of the code is kept byte for byte.
+func rewriteSelectors(filename string, code []byte, rewrite func(pkg, name string) (string, bool)) ([]byte, error) {
+	fset, file, err := parseResolved(filename, code)
+	if err != nil {
+		return nil, err
+	}
+	return rewriteFileSelectors(fset, file, code, rewrite), nil
+}
+
+// parseResolved parses a file's code, resolving identifiers to the declarations of the file.
+// Identifiers left unresolved refer to imported packages, predeclared names or other files.
+func parseResolved(filename string, code []byte) (*token.FileSet, *ast.File, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, code, 0)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing file")
+	}
+	return fset, file, nil
+}
+
+// rewriteFileSelectors is rewriteSelectors on a file parsed by parseResolved.
+func rewriteFileSelectors(
+	fset *token.FileSet,
+	file *ast.File,
+	code []byte,
+	rewrite func(pkg, name string) (string, bool),
+) []byte {
+	type edit struct {
+		sel         *ast.SelectorExpr
+		replacement string
+	}
+	var edits []edit
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				if replacement, ok := rewrite(ident.Name, sel.Sel.Name); ok {
+					edits = append(edits, edit{sel: sel, replacement: replacement})
+				}
+			}
+		}
+		return true
+	})
+	if len(edits) == 0 {
+		return code
+	}
+
+	// Edit from the end so earlier offsets stay valid.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].sel.Pos() > edits[j].sel.Pos() })
+
+	out := append([]byte(nil), code...)
+	for _, e := range edits {
+		start := fset.Position(e.sel.Pos()).Offset
+		end := fset.Position(e.sel.End()).Offset
+		out = append(out[:start], append([]byte(e.replacement), out[end:]...)...)
+	}
+	return out
+}
+
+// shadowedNames returns the names declared in a file parsed by parseResolved, at package level or
+// locally: variables, constants, types, functions, parameters and results. An import by one of
+// these names is shadowed in part of the file. Struct fields and labels don't shadow packages.
+func shadowedNames(file *ast.File) map[string]bool {
+	fields := make(map[any]bool)
+	names := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.StructType:
+			for _, f := range n.Fields.List {
+				fields[f] = true
+			}
+		case *ast.InterfaceType:
+			for _, f := range n.Methods.List {
+				fields[f] = true
+			}
+		case *ast.Ident:
+			if n.Obj != nil && n.Obj.Kind != ast.Lbl && !fields[n.Obj.Decl] {
+				names[n.Name] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// shadowedName returns the first of names that is shadowed, empty if none is.
+func shadowedName(shadowed map[string]bool, names ...string) string {
+	for _, name := range names {
+		if shadowed[name] {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/entities"
+)
+
+// ruleDescriptions describes the rules reported in check mode.
+var ruleDescriptions = map[string]string{
+	RuleUnsorted:          "Imports are not grouped and sorted.",
+	RuleInternalImport:    "Import of another project's internal package.",
+	RuleImportConflict:    "Imports binding the same name.",
+	RuleAliasPolicy:       "Import alias violating the alias policy.",
+	RuleInconsistentAlias: "Import by another name than most files use.",
+	RuleBlankComment:      "Blank import without a justification comment.",
+	RuleDotImport:         "Dot import outside a test file.",
+	RuleBannedImport:      "Import banned by an import rule.",
+	RuleDeprecatedImport:  "Import deprecated by an import rule.",
+	RuleArchitecture:      "Import denied by an architecture rule.",
+	RuleShadowedImport:    "Fix not applied because the import's name is shadowed.",
+}
+
+// WriteDiagnostics writes check mode diagnostics in an output format: one per line for text,
+// a JSON array for json, or a SARIF 2.1.0 log for sarif.
+func WriteDiagnostics(w io.Writer, format string, diagnostics []entities.Diagnostic) error {
+	switch format {
+	case "", config.FormatText:
+		for _, d := range diagnostics {
+			_, err := fmt.Fprintln(w, d)
+			if err != nil {
+				return errors.Wrap(err, "writing diagnostics")
+			}
+		}
+		return nil
+
+	case config.FormatJSON:
+		if diagnostics == nil {
+			diagnostics = []entities.Diagnostic{}
+		}
+		return writeJSON(w, diagnostics)
+
+	case config.FormatSARIF:
+		return writeJSON(w, sarifLog(diagnostics))
+
+	default:
+		return errors.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeJSON writes a value as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(v), "writing JSON")
+}
+
+// SARIF 2.1.0 log, limited to the properties goimporter reports.
+type (
+	sarif struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine int `json:"startLine"`
+	}
+)
+
+// sarifLog converts diagnostics to a SARIF log with a single run, listing the rules reported.
+func sarifLog(diagnostics []entities.Diagnostic) sarif {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "goimporter",
+			InformationURI: "https://github.com/HexArchy/goimporter",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	var rules []string
+	for _, d := range diagnostics {
+		if !slices.Contains(rules, d.Rule) {
+			rules = append(rules, d.Rule)
+		}
+
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(d.File)},
+		}}
+		if d.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line}
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    d.Rule,
+			Level:     "error",
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	slices.Sort(rules)
+	for _, rule := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               rule,
+			ShortDescription: sarifMessage{Text: ruleDescriptions[rule]},
+		})
+	}
+
+	return sarif{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}
+}
@@ -0,0 +1,189 @@
+package formatter
+
+import (
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/mod/module"
+
+	"goimporter/entities"
+)
+
+// packageNames caches resolved package names by module directory and import path.
+var packageNames sync.Map
+
+// PackageName returns the name of the package at an import path, read from its package clause.
+// The package is looked up in GOROOT, the module itself, locally replaced modules, the vendor
+// directory and the module cache. If it can't be found, the name is assumed from the import path.
+func PackageName(importPath string, mod *entities.Module) string {
+	key := importPath
+	if mod != nil {
+		key = mod.Dir + "\x00" + importPath
+	}
+	if name, ok := packageNames.Load(key); ok {
+		return name.(string)
+	}
+
+	name := ""
+	if dir := packageDir(importPath, mod); dir != "" {
+		name = readPackageName(dir)
+	}
+	if name == "" {
+		name = assumedPackageName(importPath)
+	}
+
+	packageNames.Store(key, name)
+	return name
+}
+
+// packageDir returns the directory of the package at an import path, or an empty string if it can't be found.
+func packageDir(importPath string, mod *entities.Module) string {
+	var candidates []string
+	if isStdlib(importPath) {
+		candidates = append(candidates, filepath.Join(build.Default.GOROOT, "src", filepath.FromSlash(importPath)))
+	}
+
+	if mod != nil {
+		if rel, ok := trimModule(importPath, mod.Path); ok {
+			candidates = append(candidates, filepath.Join(mod.Dir, rel))
+		}
+
+		for _, r := range mod.Replaces {
+			rel, ok := trimModule(importPath, r.Old)
+			if !ok || !r.Local {
+				continue
+			}
+			dir := filepath.FromSlash(r.New)
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(mod.Dir, dir)
+			}
+			candidates = append(candidates, filepath.Join(dir, rel))
+		}
+
+		candidates = append(candidates, filepath.Join(mod.Dir, "vendor", filepath.FromSlash(importPath)))
+
+		if dir := moduleCacheDir(importPath, mod); dir != "" {
+			candidates = append(candidates, dir)
+		}
+	}
+
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// moduleCacheDir returns the directory of a package in the module cache, following the version
+// required by go.mod, or an empty string if no required module provides it.
+func moduleCacheDir(importPath string, mod *entities.Module) string {
+	// The longest required module path containing the package provides it.
+	var modPath, version, rel string
+	for _, r := range mod.Requires {
+		if p, ok := trimModule(importPath, r.Path); ok && len(r.Path) > len(modPath) {
+			modPath, version, rel = r.Path, r.Version, p
+		}
+	}
+	if modPath == "" {
+		return ""
+	}
+
+	// Replacements by another module version live in the cache under the new path.
+	for _, r := range mod.Replaces {
+		if r.Old == modPath && !r.Local {
+			modPath, version = r.New, r.NewVersion
+		}
+	}
+
+	escapedPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return ""
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(moduleCacheRoot(), filepath.FromSlash(escapedPath)+"@"+escapedVersion, rel)
+}
+
+// moduleCacheRoot returns the module cache directory, GOMODCACHE or GOPATH/pkg/mod.
+func moduleCacheRoot() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// trimModule returns the directory of a package relative to a module containing it.
+func trimModule(importPath, modPath string) (string, bool) {
+	if modPath == "" {
+		return "", false
+	}
+	if importPath == modPath {
+		return "", true
+	}
+	if strings.HasPrefix(importPath, modPath+"/") {
+		return filepath.FromSlash(strings.TrimPrefix(importPath, modPath+"/")), true
+	}
+	return "", false
+}
+
+// readPackageName reads the package name of the Go files in a directory, ignoring test files
+// and files excluded by build constraints such as "//go:build ignore".
+func readPackageName(dir string) string {
+	pkg, err := build.ImportDir(dir, 0)
+	if pkg != nil && pkg.Name != "" {
+		return pkg.Name
+	}
+
+	// Packages without files for the current platform still have a name.
+	if _, ok := err.(*build.NoGoError); ok && len(pkg.IgnoredGoFiles) > 0 {
+		ctx := build.Default
+		ctx.UseAllFiles = true
+		if pkg, _ := ctx.ImportDir(dir, 0); pkg != nil {
+			return pkg.Name
+		}
+	}
+	return ""
+}
+
+// assumedPackageName guesses the package name of an import path the way goimports does:
+// the last path element without version suffixes, a "go-" prefix or anything after
+// the first character that is not valid in an identifier (e.g. "gopkg.in/yaml.v3" is "yaml").
+func assumedPackageName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(importPath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, notIdentifier); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// notIdentifier checks if a rune can't be part of an identifier.
+func notIdentifier(r rune) bool {
+	return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// isStdlib checks if an import path belongs to the standard library (no dot in the first element).
+func isStdlib(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
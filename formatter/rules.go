@@ -0,0 +1,220 @@
+package formatter
+
+import (
+	"fmt"
+	"go/ast"
+	"maps"
+	"slices"
+	"strings"
+
+	"goimporter/entities"
+)
+
+// matchImportRule returns the first rule applying to an import path together with the path replacing it,
+// empty for banned imports and rules replacing only selectors.
+func matchImportRule(importPath string, rules []entities.ImportRule) (*entities.ImportRule, string) {
+	for i, rule := range rules {
+		base, prefix := strings.CutSuffix(rule.Path, "/...")
+		switch {
+		case !prefix && importPath == rule.Path:
+			return &rules[i], rule.Replacement
+		case prefix && (importPath == base || strings.HasPrefix(importPath, base+"/")):
+			replacement := ""
+			if rule.Replacement != "" {
+				replacement = strings.TrimSuffix(rule.Replacement, "/...") + importPath[len(base):]
+			}
+			return &rules[i], replacement
+		}
+	}
+	return nil, ""
+}
+
+// importRuleViolations finds banned and deprecated imports, for check mode.
+func importRuleViolations(imports []entities.Import, rules []entities.ImportRule) []finding {
+	var findings []finding
+	for _, imp := range imports {
+		rule, replacement := matchImportRule(imp.Path, rules)
+		if rule == nil {
+			continue
+		}
+
+		f := finding{imp: imp, rule: RuleDeprecatedImport}
+		switch {
+		case !rule.Deprecated():
+			f.rule = RuleBannedImport
+			f.message = fmt.Sprintf("import of %q is banned", imp.Path)
+		case replacement != "":
+			f.message = fmt.Sprintf("%q is deprecated, use %q", imp.Path, replacement)
+		default:
+			f.message = fmt.Sprintf("%q is deprecated", imp.Path)
+		}
+		if rule.Message != "" {
+			f.message += ": " + rule.Message
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// FixImportRules replaces the deprecated imports of a file and rewrites their uses in its code.
+// Selected names with a replacement are rewritten first, importing their packages as needed, and an
+// import left unused by that is dropped. Remaining imports move to their replacement path; if the
+// package name changes, its uses are renamed, or the old name is kept as an alias where the new
+// one would clash with another import or a declaration of the file, or either name is shadowed.
+func FixImportRules(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	rules []entities.ImportRule,
+	mod *entities.Module,
+) ([]byte, []entities.Import, error) {
+	code, imports, _, err := fixImportRules(filename, code, imports, rules, mod)
+	return code, imports, err
+}
+
+// fixImportRules is FixImportRules, also returning the selector replacements refused because the
+// name of the deprecated import or of the replacement's package is shadowed by a declaration of the file.
+func fixImportRules(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	rules []entities.ImportRule,
+	mod *entities.Module,
+) ([]byte, []entities.Import, []finding, error) {
+	deprecated := false
+	for _, imp := range imports {
+		if rule, _ := matchImportRule(imp.Path, rules); rule != nil && rule.Deprecated() {
+			deprecated = true
+		}
+	}
+	if !deprecated {
+		return code, imports, nil, nil
+	}
+
+	fset, file, err := parseResolved(filename, code)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	shadowed := shadowedNames(file)
+
+	// Names that a replaced or added import must not take.
+	taken := make(map[string]bool)
+	for _, imp := range imports {
+		taken[ImportName(imp, mod)] = true
+	}
+	for _, name := range declaredNames(file) {
+		taken[name] = true
+	}
+
+	// Replace selected names, importing the packages of their replacements.
+	uses := selectedNames(file)
+	fixed := append([]entities.Import(nil), imports...)
+	selectors := make(map[string]map[string]string)
+	dropped := make(map[entities.Import]bool)
+	var refused []finding
+	for _, imp := range imports {
+		rule, _ := matchImportRule(imp.Path, rules)
+		if rule == nil || len(rule.Selectors) == 0 || imp.Alias == "_" || imp.Alias == "." {
+			continue
+		}
+
+		name := ImportName(imp, mod)
+		replaced := make(map[string]string)
+		for _, sel := range slices.Sorted(maps.Keys(uses[name])) {
+			target, ok := rule.Selectors[sel]
+			if !ok {
+				continue
+			}
+			i := strings.LastIndex(target, ".")
+			pkg := importedAs(fixed, target[:i], mod)
+			imported := pkg != ""
+			if !imported {
+				pkg = PackageName(target[:i], mod)
+			}
+			if shadow := shadowedName(shadowed, name, pkg); shadow != "" {
+				refused = append(refused, finding{
+					imp:  imp,
+					rule: RuleShadowedImport,
+					message: fmt.Sprintf("%s.%s is not replaced with %s: %s is shadowed by a declaration in the file",
+						name, sel, target, shadow),
+				})
+				continue
+			}
+			if !imported {
+				if taken[pkg] {
+					continue
+				}
+				taken[pkg] = true
+				fixed = append(fixed, entities.Import{Path: target[:i]})
+			}
+			replaced[sel] = pkg + "." + target[i+1:]
+		}
+
+		selectors[name] = replaced
+		if len(replaced) > 0 && len(replaced) == len(uses[name]) {
+			dropped[imp] = true
+		}
+	}
+
+	code = rewriteFileSelectors(fset, file, code, func(pkg, name string) (string, bool) {
+		replacement, ok := selectors[pkg][name]
+		return replacement, ok
+	})
+
+	// Move the remaining imports to their replacement paths.
+	renames := make(map[string]string)
+	kept := fixed[:0]
+	for _, imp := range fixed {
+		if dropped[imp] {
+			continue
+		}
+
+		if _, replacement := matchImportRule(imp.Path, rules); replacement != "" {
+			oldName, newName := ImportName(imp, mod), PackageName(replacement, mod)
+			imp.Path = replacement
+			if imp.Alias == "" && oldName != newName {
+				if taken[newName] || shadowed[oldName] {
+					imp.Alias = oldName
+				} else {
+					taken[newName] = true
+					renames[oldName] = newName
+				}
+			}
+		}
+		kept = append(kept, imp)
+	}
+
+	code, err = RenameSelectors(filename, code, renames)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return code, kept, refused, nil
+}
+
+// importedAs returns the name an import path is imported by, empty if it isn't imported by name.
+func importedAs(imports []entities.Import, importPath string, mod *entities.Module) string {
+	for _, imp := range imports {
+		if imp.Path == importPath && imp.Alias != "_" && imp.Alias != "." {
+			return ImportName(imp, mod)
+		}
+	}
+	return ""
+}
+
+// selectedNames returns the names selected from each package name in a file parsed by parseResolved,
+// such as Println from fmt. Selectors on declarations of the file are left out.
+func selectedNames(file *ast.File) map[string]map[string]bool {
+	names := make(map[string]map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				if names[ident.Name] == nil {
+					names[ident.Name] = make(map[string]bool)
+				}
+				names[ident.Name][sel.Sel.Name] = true
+			}
+		}
+		return true
+	})
+	return names
+}
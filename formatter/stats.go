@@ -0,0 +1,241 @@
+package formatter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/entities"
+)
+
+// CollectStats summarises the imports of the files of cfg: the external modules imported most,
+// the files importing each project's internal packages, the aliases of import paths imported
+// with one, and the files with the most imports. Lists other than project internals are limited
+// to the top entries, unless top is 0.
+func CollectStats(cfg *config.Config, top int) (*entities.Stats, error) {
+	stats := &entities.Stats{
+		ProjectInternal: []entities.InternalStat{},
+		Aliases:         []entities.AliasStat{},
+		LargestFiles:    []entities.Count{},
+	}
+	modules := make(map[string]int)
+	internal := make(map[string]*entities.InternalStat)
+	aliases := make(map[string]map[string]int)
+
+	handle := func(path string) error {
+		repo, err := cfg.RepoFor(path)
+		if err != nil {
+			return errors.Wrap(err, "resolving config")
+		}
+
+		code, err := os.ReadFile(path)
+		if err == nil {
+			var imports []entities.Import
+			imports, err = AllImports(code)
+			if err == nil && len(imports) > 0 {
+				addFileStats(stats, modules, internal, aliases, path, imports, repo)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", path, err)
+		}
+		return nil
+	}
+
+	err := walkGoFiles(cfg, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Modules = sortCounts(modules)
+	for _, s := range internal {
+		stats.ProjectInternal = append(stats.ProjectInternal, *s)
+	}
+	sort.Slice(stats.ProjectInternal, func(i, j int) bool {
+		a, b := stats.ProjectInternal[i], stats.ProjectInternal[j]
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+		return a.Project < b.Project
+	})
+
+	for importPath, names := range aliases {
+		if len(names) == 1 && names[""] > 0 {
+			continue
+		}
+		stats.Aliases = append(stats.Aliases, entities.AliasStat{
+			Path:         importPath,
+			Aliases:      sortCounts(names),
+			Inconsistent: len(names) > 1,
+		})
+	}
+	// Inconsistent aliases first, then the paths imported most.
+	sort.Slice(stats.Aliases, func(i, j int) bool {
+		a, b := stats.Aliases[i], stats.Aliases[j]
+		if a.Inconsistent != b.Inconsistent {
+			return a.Inconsistent
+		}
+		if totalCount(a.Aliases) != totalCount(b.Aliases) {
+			return totalCount(a.Aliases) > totalCount(b.Aliases)
+		}
+		return a.Path < b.Path
+	})
+
+	sort.SliceStable(stats.LargestFiles, func(i, j int) bool {
+		return stats.LargestFiles[i].Count > stats.LargestFiles[j].Count
+	})
+
+	if top > 0 {
+		stats.Modules = stats.Modules[:min(top, len(stats.Modules))]
+		stats.Aliases = stats.Aliases[:min(top, len(stats.Aliases))]
+		stats.LargestFiles = stats.LargestFiles[:min(top, len(stats.LargestFiles))]
+	}
+	return stats, nil
+}
+
+// addFileStats adds the imports of a file to the statistics.
+func addFileStats(
+	stats *entities.Stats,
+	modules map[string]int,
+	internal map[string]*entities.InternalStat,
+	aliases map[string]map[string]int,
+	filename string,
+	imports []entities.Import,
+	repo *entities.RepoConfig,
+) {
+	mod := fileModule(filename)
+	project := CurrentProject(filename, repo, mod)
+
+	stats.Files++
+	stats.Imports += len(imports)
+	stats.LargestFiles = append(stats.LargestFiles, entities.Count{Name: filename, Count: len(imports)})
+
+	// Modules and projects are counted once per file.
+	seen := make(map[string]bool)
+	for _, imp := range imports {
+		if imp.Alias != "_" && imp.Alias != "." {
+			if aliases[imp.Path] == nil {
+				aliases[imp.Path] = make(map[string]int)
+			}
+			aliases[imp.Path][imp.Alias]++
+		}
+
+		if pathGroup(imp.Path, repo, mod, project) == entities.GroupExternal {
+			if module := moduleOf(imp.Path, mod); !seen["module "+module] {
+				seen["module "+module] = true
+				modules[module]++
+			}
+		}
+
+		other := MatchProject(imp.Path, repo)
+		if other == nil || (!strings.HasPrefix(imp.Path, other.Root+"/internal/") && imp.Path != other.Root+"/internal") {
+			continue
+		}
+		label := projectLabel(other)
+		if seen["project "+label] {
+			continue
+		}
+		seen["project "+label] = true
+
+		if internal[label] == nil {
+			internal[label] = &entities.InternalStat{Project: label}
+		}
+		internal[label].Files++
+		if project == nil || project.Root != other.Root {
+			internal[label].Outside++
+		}
+	}
+}
+
+// moduleOf returns the module of an import path required by a module, or the path itself if unknown.
+func moduleOf(importPath string, mod *entities.Module) string {
+	module := importPath
+	if mod == nil {
+		return module
+	}
+
+	longest := 0
+	for _, r := range mod.Requires {
+		if (importPath == r.Path || strings.HasPrefix(importPath, r.Path+"/")) && len(r.Path) > longest {
+			module, longest = r.Path, len(r.Path)
+		}
+	}
+	return module
+}
+
+// sortCounts lists counts by decreasing count, then by name.
+func sortCounts(counts map[string]int) []entities.Count {
+	list := make([]entities.Count, 0, len(counts))
+	for name, count := range counts {
+		list = append(list, entities.Count{Name: name, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// totalCount sums counts.
+func totalCount(counts []entities.Count) int {
+	total := 0
+	for _, c := range counts {
+		total += c.Count
+	}
+	return total
+}
+
+// WriteStats writes import statistics as tables (text) or JSON.
+func WriteStats(w io.Writer, format string, stats *entities.Stats) error {
+	switch format {
+	case "", config.FormatText:
+	case config.FormatJSON:
+		return writeJSON(w, stats)
+	default:
+		return errors.Errorf("unknown stats format %q, use %s or %s", format, config.FormatText, config.FormatJSON)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Files\t%d\nImports\t%d\n", stats.Files, stats.Imports)
+
+	fmt.Fprintf(tw, "\nEXTERNAL MODULE\tFILES\n")
+	for _, c := range stats.Modules {
+		fmt.Fprintf(tw, "%s\t%d\n", c.Name, c.Count)
+	}
+
+	fmt.Fprintf(tw, "\nPROJECT INTERNAL\tFILES\tOUTSIDE\n")
+	for _, s := range stats.ProjectInternal {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Project, s.Files, s.Outside)
+	}
+
+	fmt.Fprintf(tw, "\nIMPORT PATH\tALIASES\n")
+	for _, s := range stats.Aliases {
+		names := make([]string, 0, len(s.Aliases))
+		for _, c := range s.Aliases {
+			name := c.Name
+			if name == "" {
+				name = "(none)"
+			}
+			names = append(names, fmt.Sprintf("%s (%d)", name, c.Count))
+		}
+		fmt.Fprintf(tw, "%s\t%s", s.Path, strings.Join(names, ", "))
+		if s.Inconsistent {
+			fmt.Fprint(tw, "\tinconsistent")
+		}
+		fmt.Fprintln(tw)
+	}
+
+	fmt.Fprintf(tw, "\nFILE\tIMPORTS\n")
+	for _, c := range stats.LargestFiles {
+		fmt.Fprintf(tw, "%s\t%d\n", c.Name, c.Count)
+	}
+	return errors.Wrap(tw.Flush(), "writing stats")
+}
@@ -0,0 +1,61 @@
+package formatter
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+
+	"github.com/pkg/errors"
+
+	"goimporter/entities"
+)
+
+// RemoveUnused drops the imports whose package is not referenced in the file.
+// Blank, dot and cgo imports are always kept.
+func RemoveUnused(
+	filename string,
+	code []byte,
+	imports []entities.Import,
+	mod *entities.Module,
+) ([]entities.Import, error) {
+	used, err := usedPackages(filename, code)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]entities.Import, 0, len(imports))
+	for _, imp := range imports {
+		if imp.Alias == "_" || imp.Alias == "." || imp.Path == "C" || used[ImportName(imp, mod)] {
+			kept = append(kept, imp)
+		}
+	}
+	return kept, nil
+}
+
+// ImportName returns the name a file refers to an import by: its alias or the package name.
+func ImportName(imp entities.Import, mod *entities.Module) string {
+	if imp.Alias != "" {
+		return imp.Alias
+	}
+	return PackageName(imp.Path, mod)
+}
+
+// usedPackages returns the names used as the package of a qualified identifier, such as fmt in fmt.Println.
+// Local variables shadowing a package name are counted too, which errs on the side of keeping imports.
+func usedPackages(filename string, code []byte) (map[string]bool, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, code, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing file")
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	return used, nil
+}
@@ -2,4 +2,9 @@ module goimporter
 
 go 1.23.0
 
-require github.com/pkg/errors v0.9.1
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/pkg/errors v0.9.1
+	golang.org/x/mod v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,119 @@
+// Package goimporter organizes and checks the imports of Go source files, for embedding in other tools.
+//
+// A Formatter works on code in memory: nothing is printed or written. The go.mod governing a file
+// and the packages it imports may still be read, to resolve package names.
+package goimporter
+
+import (
+	"maps"
+
+	"github.com/pkg/errors"
+
+	"goimporter/config"
+	"goimporter/entities"
+	"goimporter/formatter"
+)
+
+// Result is the outcome of formatting and checking a file: its code with organized imports,
+// whether that changed, and the problems found.
+type Result = entities.FileResult
+
+// Formatter organizes and checks imports with a fixed configuration.
+type Formatter struct {
+	cfg  config.Config
+	repo *entities.RepoConfig
+}
+
+// Option configures a Formatter.
+type Option func(*Formatter)
+
+// WithRepoConfig sets the repository configuration. Keys left at their zero value take the values of
+// the selected profile (e.g. Profile: "vk") or the built-in defaults, like with the command. Config
+// files are not discovered: the configuration applies to every file.
+func WithRepoConfig(repo *entities.RepoConfig) Option {
+	return func(f *Formatter) {
+		f.repo = repo
+	}
+}
+
+// WithPrefixes sets the import path prefixes of the current project, instead of deriving them
+// from the file names.
+func WithPrefixes(prefixes ...string) Option {
+	return func(f *Formatter) {
+		f.cfg.PkgPrefixes = append([]string(nil), prefixes...)
+	}
+}
+
+// WithIncludeGenerated formats generated files too.
+func WithIncludeGenerated() Option {
+	return func(f *Formatter) {
+		f.cfg.IncludeGenerated = true
+	}
+}
+
+// WithNormalizeBuild adds //go:build lines matching existing // +build lines.
+func WithNormalizeBuild() Option {
+	return func(f *Formatter) {
+		f.cfg.NormalizeBuild = true
+	}
+}
+
+// WithRemoveUnused removes imports whose package is not used.
+func WithRemoveUnused() Option {
+	return func(f *Formatter) {
+		f.cfg.RemoveUnused = true
+	}
+}
+
+// WithAddMissing adds imports for unresolved package selectors.
+func WithAddMissing() Option {
+	return func(f *Formatter) {
+		f.cfg.AddMissing = true
+	}
+}
+
+// WithFix applies the fixes for policy violations: deprecated imports and aliases.
+func WithFix() Option {
+	return func(f *Formatter) {
+		f.cfg.Fix = true
+	}
+}
+
+// WithImportNames sets the names import paths are imported by in most files, by import path,
+// which alias_policy.consistent enforces. A Formatter only sees one file at a time, so without
+// them aliases are not checked for consistency.
+func WithImportNames(names map[string]string) Option {
+	return func(f *Formatter) {
+		f.cfg.ImportNames = maps.Clone(names)
+	}
+}
+
+// New creates a Formatter from options, resolving and validating its repository configuration.
+// Without WithRepoConfig, the built-in defaults are used.
+func New(opts ...Option) (*Formatter, error) {
+	f := &Formatter{repo: &entities.RepoConfig{}}
+	for _, opt := range opts {
+		opt(f)
+	}
+	err := f.cfg.SetRepo(f.repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	return f, nil
+}
+
+// Format returns a file's code with its imports organized, and any fixes applied.
+// Generated files are returned unchanged unless included.
+func (f *Formatter) Format(src []byte, filename string) ([]byte, error) {
+	result, err := f.Check(src, filename)
+	if err != nil {
+		return nil, err
+	}
+	return result.Source, nil
+}
+
+// Check organizes the imports of a file's code and reports its problems: imports that are not
+// grouped and sorted, and import violations.
+func (f *Formatter) Check(src []byte, filename string) (*Result, error) {
+	return formatter.CheckSource(filename, src, &f.cfg)
+}
@@ -0,0 +1,164 @@
+package goimporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"goimporter/entities"
+	"goimporter/formatter"
+)
+
+func TestFormatter(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write go.mod: %v", err)
+	}
+	// The file is only given in memory.
+	filename := filepath.Join(dir, "app", "app.go")
+
+	f, err := New(
+		WithRepoConfig(&entities.RepoConfig{OrgPrefix: "example.com", RepoPrefix: "example.com/m"}),
+		WithRemoveUnused(),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	src := []byte(`package app
+
+import (
+	"example.com/m/pkg/util"
+	"os"
+	"fmt"
+)
+
+var s = fmt.Sprint(util.Name)
+`)
+	want := `package app
+
+import (
+	"fmt"
+
+	"example.com/m/pkg/util"
+)
+
+var s = fmt.Sprint(util.Name)
+`
+
+	got, err := f.Format(src, filename)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("Format() =\n%s\nwant:\n%s", got, want)
+	}
+
+	result, err := f.Check(src, filename)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !result.Changed || string(result.Source) != want {
+		t.Errorf("Check() changed = %v, source:\n%s", result.Changed, result.Source)
+	}
+	wantDiagnostics := []entities.Diagnostic{{
+		File:    filename,
+		Rule:    formatter.RuleUnsorted,
+		Message: "imports are not grouped and sorted",
+	}}
+	if !reflect.DeepEqual(result.Diagnostics, wantDiagnostics) {
+		t.Errorf("Check() diagnostics = %v, want %v", result.Diagnostics, wantDiagnostics)
+	}
+
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Check() touched %s: %v", filename, err)
+	}
+
+	generated := []byte("// Code generated by protoc. DO NOT EDIT.\n\npackage app\n\nimport (\n\t\"os\"\n\t\"fmt\"\n)\n")
+	result, err = f.Check(generated, filename)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !result.Skipped || result.Changed || string(result.Source) != string(generated) {
+		t.Errorf("Check() of a generated file = %+v, want it skipped", result)
+	}
+}
+
+func TestNewProfile(t *testing.T) {
+	src := []byte(`package app
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.mvk.com/vkapi/vk-go-sdk-private/api"
+	"fmt"
+)
+`)
+	filename := filepath.Join(t.TempDir(), "app.go")
+
+	// The vk profile groups its SDK with the organization's common packages.
+	f, err := New(WithRepoConfig(&entities.RepoConfig{Profile: "vk"}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got, err := f.Format(src, filename)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	want := `package app
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"gitlab.mvk.com/vkapi/vk-go-sdk-private/api"
+)
+`
+	if string(got) != want {
+		t.Errorf("Format() with the vk profile =\n%s\nwant:\n%s", got, want)
+	}
+
+	// Without it, the SDK is just another external package.
+	f, err = New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got, err = f.Format(src, filename)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	want = `package app
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gitlab.mvk.com/vkapi/vk-go-sdk-private/api"
+)
+`
+	if string(got) != want {
+		t.Errorf("Format() with the defaults =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		repo *entities.RepoConfig
+	}{
+		{name: "nil", repo: nil},
+		{name: "unknown profile", repo: &entities.RepoConfig{Profile: "vkk"}},
+		{name: "repo prefix outside org prefix", repo: &entities.RepoConfig{OrgPrefix: "example.com", RepoPrefix: "other.com/m"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(WithRepoConfig(tt.repo))
+			if err == nil {
+				t.Error("New() succeeded, want an error")
+			}
+		})
+	}
+}
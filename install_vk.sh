@@ -6,8 +6,9 @@ echo "🚀 Installing goimporter with VK configuration..."
 
 # Setup variables
 INSTALL_DIR="$HOME/.goimporter"
-CONFIG_DIR="$HOME/.config/goimporter"
-CONFIG_FILE="$CONFIG_DIR/vk_config.json"
+# goimporter reads its global config from $XDG_CONFIG_HOME/goimporter, or ~/.config/goimporter on every OS.
+CONFIG_DIR="${XDG_CONFIG_HOME:-$HOME/.config}/goimporter"
+CONFIG_FILE="$CONFIG_DIR/config.json"
 BINARY_PATH="$HOME/go/bin/goimporter"
 REPO_URL="https://github.com/HexArchy/goimporter.git"
 
@@ -25,20 +26,18 @@ go build -v -ldflags="-s -w" -o "$BINARY_PATH" ./cmd/goimporter
 
 # Create VK configuration
 echo "⚙️  Creating VK configuration..."
-cat > "$CONFIG_FILE" <<EOF
+if [ -f "$CONFIG_FILE" ]; then
+  echo "✅ Global config already exists at $CONFIG_FILE, leaving it as is"
+else
+  cat > "$CONFIG_FILE" <<EOF
 {
-  "org_prefix": "gitlab.mvk.com",
-  "repo_prefix": "gitlab.mvk.com/go/vkgo",
-  "common_prefix": "gitlab.mvk.com/go/vkgo/pkg",
-  "domain_prefix": "gitlab.mvk.com/go/vkgo/projects/health/pkg",
-  "projects_template": "gitlab.mvk.com/go/vkgo/projects/health/%s",
-  "additional_common_prefixes": [
-    "gitlab.mvk.com/vkapi/vk-go-sdk-private"
-  ]
+  "profile": "vk"
 }
 EOF
+  echo "✅ Global config written to $CONFIG_FILE"
+fi
 
-# Create shell alias
+# Pick the shell profile
 SHELL_CONFIG=""
 if [ -f "$HOME/.zshrc" ]; then
   SHELL_CONFIG="$HOME/.zshrc"
@@ -48,14 +47,6 @@ else
   SHELL_CONFIG="$HOME/.bashrc"
 fi
 
-if ! grep -q "alias vkgoimporter" "$SHELL_CONFIG" 2>/dev/null; then
-  echo "🔧 Adding alias to $SHELL_CONFIG..."
-  echo 'alias vkgoimporter="goimporter -config ~/.config/goimporter/vk_config.json"' >> "$SHELL_CONFIG"
-  echo "✅ Alias added. Run 'source $SHELL_CONFIG' to activate it now"
-else
-  echo "✅ Alias already exists in $SHELL_CONFIG"
-fi
-
 # Check if ~/go/bin is in PATH
 if [[ ":$PATH:" != *":$HOME/go/bin:"* ]]; then
   echo "⚠️  Warning: ~/go/bin is not in your PATH"
@@ -65,5 +56,6 @@ if [[ ":$PATH:" != *":$HOME/go/bin:"* ]]; then
 fi
 
 echo "✨ Installation complete! ✨"
-echo "You can now use 'vkgoimporter' to format Go code with VK-specific import ordering."
-echo "For example: vkgoimporter -r -dir=/path/to/project"
\ No newline at end of file
+echo "You can now use 'goimporter' to format Go code with VK-specific import ordering."
+echo "For example: goimporter -r -dir=/path/to/project"
+echo "To check that the vk profile is picked up, run: goimporter config show | grep profile"
\ No newline at end of file